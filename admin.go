@@ -1,9 +1,14 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -39,3 +44,85 @@ func (cfg *apiConfig) resetMetricsHandler(w http.ResponseWriter, req *http.Reque
 	}
 	cfg.fileserverHits.Store(0)
 }
+
+// checkAdminKey responds with an error and returns false unless the request
+// carries the ADMIN_KEY api key. The admin api is disabled when no key is
+// configured.
+func (cfg *apiConfig) checkAdminKey(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.adminKey == "" {
+		respondWithError(w, http.StatusForbidden, "admin api disabled")
+		return false
+	}
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "could not find api key")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "wrong api key")
+		return false
+	}
+	return true
+}
+
+// adminRevokeTokens signs a user out of every session and deletes their
+// personal access tokens.
+func (cfg *apiConfig) adminRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	if !cfg.checkAdminKey(w, r) {
+		return
+	}
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	if _, err := cfg.dB.GetUserByID(r.Context(), userId); err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	notBefore, err := cfg.revokeUserTokens(r.Context(), cfg.dB, userId)
+	if err != nil {
+		log.Printf("could not revoke tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	cfg.revocations.setCutoff(userId, notBefore)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModeratedChirp is the text a user wrote before banned words were replaced.
+type ModeratedChirp struct {
+	ID           uuid.UUID `json:"id"`
+	ChirpID      uuid.UUID `json:"chirp_id"`
+	OriginalBody string    `json:"original_body"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// getModeratedChirps shows moderators what a chirp said before the profanity
+// filter cleaned it, one entry per moderated post or edit.
+func (cfg *apiConfig) getModeratedChirps(w http.ResponseWriter, r *http.Request) {
+	if !cfg.checkAdminKey(w, r) {
+		return
+	}
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	rows, err := cfg.dB.GetModeratedChirps(r.Context(), chirpId)
+	if err != nil {
+		log.Printf("could not get moderated chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	moderated := []ModeratedChirp{}
+	for _, row := range rows {
+		moderated = append(moderated, ModeratedChirp{
+			ID:           row.ID,
+			ChirpID:      row.ChirpID,
+			OriginalBody: row.OriginalBody,
+			CreatedAt:    row.CreatedAt,
+		})
+	}
+	responseWithJson(w, http.StatusOK, moderated)
+}
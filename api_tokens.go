@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAPITokenNameLength = 100
+	maxAPITokenDays       = 365
+	// apiTokenUseGranularity is how stale last_used_at may get before a
+	// request through the token updates it.
+	apiTokenUseGranularity = time.Minute
+)
+
+// APIToken is a personal access token. The token itself is only included in
+// the response that creates it.
+type APIToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func nullTimePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func newAPIToken(token database.ApiToken) APIToken {
+	return APIToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  nullTimePointer(token.ExpiresAt),
+		LastUsedAt: nullTimePointer(token.LastUsedAt),
+	}
+}
+
+// personalTokenClaims looks up a personal access token and records that it
+// was used, at most once a minute. The claims carry the scopes the token was
+// created with.
+func (cfg *apiConfig) personalTokenClaims(ctx context.Context, token string) (*auth.Claims, uuid.UUID, error) {
+	row, err := cfg.dB.GetAPITokenByHash(ctx, auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, uuid.Nil, errors.New("unknown or expired personal access token")
+	}
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("could not get personal access token: %w", err)
+	}
+	if !row.LastUsedAt.Valid || time.Since(row.LastUsedAt.Time) > apiTokenUseGranularity {
+		// failing to record the use should not fail the request
+		if err := cfg.dB.TouchAPIToken(ctx, row.ID); err != nil {
+			log.Printf("could not record personal access token use: %s", err)
+		}
+	}
+	claims := auth.NewClaims(row.UserID, false, row.Scopes...)
+	claims.ID = row.ID.String()
+	return &claims, row.UserID, nil
+}
+
+// createAPIToken creates a personal access token for the user. It needs a
+// login access token, so a personal access token cannot create more.
+func (cfg *apiConfig) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	var req apiTokenRequest
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPITokenNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxAPITokenNameLength))
+		return
+	}
+	if err := auth.CheckScopes(req.Scopes); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPITokenDays {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be 0 to %d", maxAPITokenDays))
+		return
+	}
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+	token := auth.MakePersonalToken()
+	row, err := cfg.dB.CreateAPIToken(r.Context(), database.CreateAPITokenParams{
+		UserID:    user_id,
+		Name:      name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    req.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("could not create api token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	created := newAPIToken(row)
+	created.Token = token
+	responseWithJson(w, http.StatusCreated, created)
+}
+
+func (cfg *apiConfig) getAPITokens(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	rows, err := cfg.dB.ListAPITokens(r.Context(), user_id)
+	if err != nil {
+		log.Printf("could not list api tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	tokens := []APIToken{}
+	for _, row := range rows {
+		tokens = append(tokens, newAPIToken(row))
+	}
+	responseWithJson(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) deleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	tokenId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	rows, err := cfg.dB.DeleteAPIToken(r.Context(), database.DeleteAPITokenParams{
+		ID:     tokenId,
+		UserID: user_id,
+	})
+	if err != nil {
+		log.Printf("could not delete api token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
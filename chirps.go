@@ -1,141 +1,532 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
-	"sort"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/NHemmerly/http-servers/internal/auth"
 	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/validation"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserId    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	Edited    bool       `json:"edited"`
+	LikeCount int64      `json:"like_count"`
+	LikedByMe *bool      `json:"liked_by_me,omitempty"`
 }
 
-func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-	access, err := auth.GetBearerToken(r.Header)
+// ThreadNode is a chirp in a conversation tree. Deleted chirps that still
+// have replies stay in the tree as placeholders with an empty body.
+type ThreadNode struct {
+	Chirp
+	Deleted    bool          `json:"deleted"`
+	ReplyCount int           `json:"reply_count"`
+	Replies    []*ThreadNode `json:"replies"`
+}
+
+type chirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type chirpSearchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type chirpSearchPage struct {
+	Results    []chirpSearchResult `json:"results"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+		InReplyTo: parentFromDB(chirp.ParentID),
+		Edited:    chirp.UpdatedAt.After(chirp.CreatedAt),
+	}
+}
+
+func chirpPointers(chirps []Chirp) []*Chirp {
+	pointers := make([]*Chirp, 0, len(chirps))
+	for i := range chirps {
+		pointers = append(pointers, &chirps[i])
+	}
+	return pointers
+}
+
+// respondWithLikes attaches like information for the requesting user. It
+// reports false, after responding with an error, if the lookup failed.
+func (cfg *apiConfig) respondWithLikes(w http.ResponseWriter, r *http.Request, chirps ...*Chirp) bool {
+	if err := cfg.attachLikes(r.Context(), cfg.optionalViewer(r), chirps...); err != nil {
+		log.Printf("could not attach likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return false
+	}
+	return true
+}
+
+func parentFromDB(parentId uuid.NullUUID) *uuid.UUID {
+	if !parentId.Valid {
+		return nil
+	}
+	return &parentId.UUID
+}
+
+type ChirpEdit struct {
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// authorizeChirpOwner looks up the chirp named by the chirpID path value and
+// checks that it belongs to userId. On failure it responds to the client and
+// returns false.
+func authorizeChirpOwner(w http.ResponseWriter, r *http.Request, userId uuid.UUID, lookup func(context.Context, uuid.UUID) (database.Chirp, error)) (database.Chirp, bool) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "no access token")
-		return
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return database.Chirp{}, false
+	}
+	chirp, err := lookup(r.Context(), chirpId)
+	if err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return database.Chirp{}, false
 	}
-	user_id, err := auth.ValidateJWT(access, cfg.secret)
+	if chirp.UserID != userId {
+		respondWithError(w, http.StatusForbidden, "Unauthorized")
+		return database.Chirp{}, false
+	}
+	return chirp, true
+}
+
+// cleanChirpBody validates a chirp body and replaces banned words in it; the
+// original is kept for moderators. The cleaned text is what gets stored, and
+// a replacement can be longer than the word it hides, so it is validated too.
+func (cfg *apiConfig) cleanChirpBody(raw string) (body, cleaned string, moderated bool, err error) {
+	body, err = validation.ChirpBody(raw)
 	if err != nil {
-		log.Printf("could not validate user: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
-		return
+		return "", "", false, err
 	}
-	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	cleaned, moderated = cfg.profanity.Clean(body)
+	if moderated {
+		if cleaned, err = validation.ChirpBody(cleaned); err != nil {
+			return "", "", false, err
+		}
+	}
+	return body, cleaned, moderated, nil
+}
+
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not parse path")
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
 		return
 	}
-	chirp, err := cfg.dB.GetChirpByID(r.Context(), chirpId)
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "chirp not found")
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	if chirp.UserID != user_id {
-		respondWithError(w, http.StatusForbidden, "Unauthorized")
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	chirp, ok := authorizeChirpOwner(w, r, user_id, qtx.GetChirpByIDForUpdate)
+	if !ok {
+		return
+	}
+	hasReplies, err := qtx.ChirpHasReplies(r.Context(), uuid.NullUUID{UUID: chirp.ID, Valid: true})
+	if err != nil {
+		log.Printf("could not check for replies: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	if err := cfg.dB.DeleteChirp(r.Context(), database.DeleteChirpParams{
-		ID:     chirpId,
+	if hasReplies {
+		// keep a placeholder so the replies stay in their thread
+		if err := qtx.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+			ID:     chirp.ID,
+			UserID: user_id,
+		}); err != nil {
+			respondWithError(w, http.StatusForbidden, "Unauthorized")
+			return
+		}
+		if err := qtx.DeleteChirpEdits(r.Context(), chirp.ID); err != nil {
+			log.Printf("could not delete chirp edits: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+	} else if err := qtx.DeleteChirp(r.Context(), database.DeleteChirpParams{
+		ID:     chirp.ID,
 		UserID: user_id,
 	}); err != nil {
 		respondWithError(w, http.StatusForbidden, "Unauthorized")
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit chirp deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
 	responseWithJson(w, http.StatusNoContent, "Chirp deleted")
 }
 
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+	params := parameters{}
+	if err := params.decodeRequest(w, r); err != nil {
+		return
+	}
+	body, cleaned, moderated, err := cfg.cleanChirpBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	// lock the row so concurrent edits are recorded one after another
+	previous, ok := authorizeChirpOwner(w, r, user_id, qtx.GetChirpByIDForUpdate)
+	if !ok {
+		return
+	}
+	if err := qtx.CreateChirpEdit(r.Context(), database.CreateChirpEditParams{
+		ChirpID:   previous.ID,
+		Body:      previous.Body,
+		CreatedAt: previous.UpdatedAt,
+	}); err != nil {
+		log.Printf("could not record chirp edit: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	chirp, err := qtx.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		Body:   cleaned,
+		ID:     previous.ID,
+		UserID: user_id,
+	})
+	if err != nil {
+		log.Printf("could not update chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if moderated {
+		if err := qtx.CreateModeratedChirp(r.Context(), database.CreateModeratedChirpParams{
+			ChirpID:      chirp.ID,
+			OriginalBody: body,
+		}); err != nil {
+			log.Printf("could not keep original chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit chirp edit: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	response := chirpFromDB(chirp)
+	if !cfg.respondWithLikes(w, r, &response) {
+		return
+	}
+	responseWithJson(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) getChirpEdits(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	if chirp, err := cfg.dB.GetChirpByID(r.Context(), chirpId); err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+	edits, err := cfg.dB.GetChirpEdits(r.Context(), chirpId)
+	if err != nil {
+		log.Printf("could not retrieve chirp edits: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	history := []ChirpEdit{}
+	for _, edit := range edits {
+		history = append(history, ChirpEdit{
+			Body:       edit.Body,
+			CreatedAt:  edit.CreatedAt,
+			ReplacedAt: edit.ReplacedAt,
+		})
+	}
+	responseWithJson(w, http.StatusOK, history)
+}
+
 func (cfg *apiConfig) postChirps(w http.ResponseWriter, r *http.Request) {
 	params := parameters{}
 	params.decodeRequest(w, r)
 	// bearer and token auth
-	bearer, err := auth.GetBearerToken(r.Header)
+	uuid, err := cfg.authorize(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		log.Printf("could not get bearer: %s", err)
+		log.Printf("could not validate jwt: %s", err)
+		respondAuthError(w, err)
 		return
 	}
-	uuid, err := auth.ValidateJWT(bearer, cfg.secret)
+	author, err := cfg.dB.GetUserByID(r.Context(), uuid)
 	if err != nil {
-		log.Printf("%s", uuid)
-		log.Printf("could not validate jwt: %s", err)
-		respondWithError(w, 401, "Unauthorized")
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	// chirp length verification
-	if len(params.Body) > 140 {
-		respondWithError(w, 400, "Chirp is too long")
+	if !author.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "verify your email address before chirping")
 		return
 	}
-	chirp, err := cfg.dB.CreateChirp(r.Context(), database.CreateChirpParams{
-		UserID: uuid,
-		Body:   params.Body,
+	// chirp length and content verification
+	body, cleaned, moderated, err := cfg.cleanChirpBody(params.Body)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if params.InReplyTo.Valid {
+		parent, err := cfg.dB.GetChirpByID(r.Context(), params.InReplyTo.UUID)
+		if err != nil || parent.DeletedAt.Valid {
+			respondWithError(w, http.StatusNotFound, "parent chirp not found")
+			return
+		}
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		UserID:   uuid,
+		Body:     cleaned,
+		ParentID: params.InReplyTo,
 	})
 	if err != nil {
 		log.Printf("could not create chirp: %s", err)
 		return
 	}
-	responseWithJson(w, 201, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	if moderated {
+		if err := qtx.CreateModeratedChirp(r.Context(), database.CreateModeratedChirpParams{
+			ChirpID:      chirp.ID,
+			OriginalBody: body,
+		}); err != nil {
+			log.Printf("could not keep original chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	responseWithJson(w, 201, chirpFromDB(chirp))
+}
+
+// chirpFilter holds the listing filters shared by the chirp endpoints.
+type chirpFilter struct {
+	AuthorIds     []uuid.UUID
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+}
+
+func parseChirpFilter(query url.Values) (chirpFilter, error) {
+	var filter chirpFilter
+	// author_id may be repeated or hold a comma separated list
+	for _, value := range query["author_id"] {
+		for _, idString := range strings.Split(value, ",") {
+			if idString = strings.TrimSpace(idString); idString == "" {
+				continue
+			}
+			id, err := uuid.Parse(idString)
+			if err != nil {
+				return chirpFilter{}, fmt.Errorf("invalid author_id")
+			}
+			filter.AuthorIds = append(filter.AuthorIds, id)
+		}
+	}
+	var err error
+	if filter.CreatedAfter, err = parseTimeParam(query.Get("created_after")); err != nil {
+		return chirpFilter{}, fmt.Errorf("invalid created_after")
+	}
+	if filter.CreatedBefore, err = parseTimeParam(query.Get("created_before")); err != nil {
+		return chirpFilter{}, fmt.Errorf("invalid created_before")
+	}
+	return filter, nil
+}
+
+func parseTimeParam(s string) (sql.NullTime, error) {
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	// created_at is stored without a time zone, in UTC
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
 }
 
 func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	after, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	filter, err := parseChirpFilter(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sortString := query.Get("sort")
+	if sortString != "" && sortString != "asc" && sortString != "desc" {
+		respondWithError(w, http.StatusBadRequest, "sort must be asc or desc")
+		return
+	}
+	cursorCreatedAt, cursorId := after.params()
+	// fetch one extra row to learn whether another page exists
 	var chirps []database.Chirp
-	var descend bool
-	userIdString := r.URL.Query().Get("author_id")
-	sortString := r.URL.Query().Get("sort")
 	if sortString == "desc" {
-		descend = true
+		chirps, err = cfg.dB.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorIds:       filter.AuthorIds,
+			CreatedAfter:    filter.CreatedAfter,
+			CreatedBefore:   filter.CreatedBefore,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			RowLimit:        limit + 1,
+		})
 	} else {
-		descend = false
+		chirps, err = cfg.dB.ListChirps(r.Context(), database.ListChirpsParams{
+			AuthorIds:       filter.AuthorIds,
+			CreatedAfter:    filter.CreatedAfter,
+			CreatedBefore:   filter.CreatedBefore,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			RowLimit:        limit + 1,
+		})
 	}
-	if userIdString != "" {
-		userId, err := uuid.Parse(userIdString)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "server error")
-			return
-		}
-		chirps, err = cfg.dB.GetChirpsByUser(r.Context(), userId)
-		if err != nil {
-			respondWithError(w, http.StatusNotFound, "user chirps not found")
-			return
-		}
-	} else {
-		var err error
-		chirps, err = cfg.dB.GetChirps(r.Context())
-		if err != nil {
-			log.Printf("could not retrieve all users: %s", err)
-			return
-		}
+	if err != nil {
+		log.Printf("could not retrieve chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	page := chirpPage{Chirps: []Chirp{}}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
 	}
-	var chirpArray []Chirp
 	for _, chirp := range chirps {
-		chirpArray = append(chirpArray, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserId:    chirp.UserID,
+		page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+	}
+	if !cfg.respondWithLikes(w, r, chirpPointers(page.Chirps)...) {
+		return
+	}
+	responseWithJson(w, 200, page)
+}
+
+func (cfg *apiConfig) searchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if searchQuery == "" {
+		respondWithError(w, http.StatusBadRequest, "missing search query")
+		return
+	}
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := decodeOffsetCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	filter, err := parseChirpFilter(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := cfg.dB.SearchChirps(r.Context(), database.SearchChirpsParams{
+		SearchQuery:   searchQuery,
+		AuthorIds:     filter.AuthorIds,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		RowLimit:      limit + 1,
+		RowOffset:     offset,
+	})
+	if err != nil {
+		log.Printf("could not search chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	page := chirpSearchPage{Results: []chirpSearchResult{}}
+	if len(results) > int(limit) {
+		results = results[:limit]
+		if offset+limit <= maxPageOffset {
+			page.NextCursor = encodeOffsetCursor(offset + limit)
+		}
+	}
+	for _, result := range results {
+		page.Results = append(page.Results, chirpSearchResult{
+			Chirp: Chirp{
+				ID:        result.ID,
+				CreatedAt: result.CreatedAt,
+				UpdatedAt: result.UpdatedAt,
+				Body:      result.Body,
+				UserId:    result.UserID,
+				InReplyTo: parentFromDB(result.ParentID),
+				Edited:    result.UpdatedAt.After(result.CreatedAt),
+			},
+			Rank:    result.Rank,
+			Snippet: result.Snippet,
 		})
 	}
-	if descend {
-		sort.Slice(chirpArray, func(i, j int) bool { return chirpArray[i].CreatedAt.After(chirpArray[j].CreatedAt) })
+	resultChirps := make([]*Chirp, 0, len(page.Results))
+	for i := range page.Results {
+		resultChirps = append(resultChirps, &page.Results[i].Chirp)
+	}
+	if !cfg.respondWithLikes(w, r, resultChirps...) {
+		return
 	}
-	responseWithJson(w, 200, chirpArray)
+	responseWithJson(w, 200, page)
 }
 
 func (cfg *apiConfig) getChirpById(w http.ResponseWriter, r *http.Request) {
@@ -145,15 +536,63 @@ func (cfg *apiConfig) getChirpById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	chirp, err := cfg.dB.GetChirpByID(r.Context(), chirpId)
-	if err != nil {
+	if err != nil || chirp.DeletedAt.Valid {
 		respondWithError(w, 404, "chirp not found")
 		return
 	}
-	responseWithJson(w, 200, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	response := chirpFromDB(chirp)
+	if !cfg.respondWithLikes(w, r, &response) {
+		return
+	}
+	responseWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) getThread(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	rootId, err := cfg.dB.GetThreadRootID(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+	chirps, err := cfg.dB.GetThread(r.Context(), rootId)
+	if err != nil {
+		log.Printf("could not retrieve thread: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	// rows come back oldest first, so every parent is seen before its replies
+	nodes := make(map[uuid.UUID]*ThreadNode, len(chirps))
+	var root *ThreadNode
+	for _, chirp := range chirps {
+		node := &ThreadNode{
+			Chirp:   chirpFromDB(chirp),
+			Deleted: chirp.DeletedAt.Valid,
+			Replies: []*ThreadNode{},
+		}
+		nodes[chirp.ID] = node
+		if chirp.ID == rootId {
+			root = node
+			continue
+		}
+		if parent, ok := nodes[chirp.ParentID.UUID]; ok {
+			parent.Replies = append(parent.Replies, node)
+			parent.ReplyCount++
+		}
+	}
+	if root == nil {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+	threadChirps := make([]*Chirp, 0, len(nodes))
+	for _, node := range nodes {
+		threadChirps = append(threadChirps, &node.Chirp)
+	}
+	if !cfg.respondWithLikes(w, r, threadChirps...) {
+		return
+	}
+	responseWithJson(w, http.StatusOK, root)
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followPage struct {
+	Users      []Follow `json:"users"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// followTarget authenticates the request and looks up the user named by the
+// id path value. On failure it responds to the client and returns false.
+func (cfg *apiConfig) followTarget(w http.ResponseWriter, r *http.Request) (follower, followee uuid.UUID, ok bool) {
+	follower, err := cfg.authorize(r, auth.ScopeProfileWrite)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	followee, err = uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if follower == followee {
+		respondWithError(w, http.StatusBadRequest, "cannot follow yourself")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if _, err := cfg.dB.GetUserByID(r.Context(), followee); err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return follower, followee, true
+}
+
+func (cfg *apiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	follower, followee, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.dB.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: follower,
+		FolloweeID: followee,
+	}); err != nil {
+		log.Printf("could not follow user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	follower, followee, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.dB.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: follower,
+		FolloweeID: followee,
+	}); err != nil {
+		log.Printf("could not unfollow user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) getFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, false)
+}
+
+func (cfg *apiConfig) getFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, true)
+}
+
+// listFollows serves a page of the users following, or followed by, the
+// user named by the id path value, most recent first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, following bool) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	after, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	if _, err := cfg.dB.GetUserByID(r.Context(), userId); err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	cursorCreatedAt, cursorId := after.params()
+	var follows []Follow
+	if following {
+		rows, err := cfg.dB.ListFollowing(r.Context(), database.ListFollowingParams{
+			UserID:          userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			RowLimit:        limit + 1,
+		})
+		if err != nil {
+			log.Printf("could not retrieve following: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	} else {
+		rows, err := cfg.dB.ListFollowers(r.Context(), database.ListFollowersParams{
+			UserID:          userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			RowLimit:        limit + 1,
+		})
+		if err != nil {
+			log.Printf("could not retrieve followers: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	}
+	page := followPage{Users: []Follow{}}
+	if len(follows) > int(limit) {
+		follows = follows[:limit]
+		last := follows[len(follows)-1]
+		page.NextCursor = encodeCursor(last.FollowedAt, last.UserID)
+	}
+	page.Users = append(page.Users, follows...)
+	responseWithJson(w, http.StatusOK, page)
+}
+
+func (cfg *apiConfig) getTimeline(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeChirpsRead)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	after, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	cursorCreatedAt, cursorId := after.params()
+	chirps, err := cfg.dB.GetTimeline(r.Context(), database.GetTimelineParams{
+		UserID:          user_id,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorId,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("could not retrieve timeline: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	page := chirpPage{Chirps: []Chirp{}}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, chirp := range chirps {
+		page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+	}
+	if err := cfg.attachLikes(r.Context(), uuid.NullUUID{UUID: user_id, Valid: true}, chirpPointers(page.Chirps)...); err != nil {
+		log.Printf("could not attach likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	responseWithJson(w, http.StatusOK, page)
+}
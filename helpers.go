@@ -2,11 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 
+	"github.com/NHemmerly/http-servers/internal/auth"
 	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
 )
 
 type upgrade struct {
@@ -22,7 +27,41 @@ type login struct {
 }
 
 type parameters struct {
-	Body string `json:"body"`
+	Body      string        `json:"body"`
+	InReplyTo uuid.NullUUID `json:"in_reply_to"`
+}
+
+type logout struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type totpCode struct {
+	Code string `json:"code"`
+}
+
+type totpLogin struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type apiTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type profileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
 }
 
 func decodeRequest(w http.ResponseWriter, req *http.Request, form interface{}) error {
@@ -44,6 +83,38 @@ func (p *parameters) decodeRequest(w http.ResponseWriter, req *http.Request) err
 	return decodeRequest(w, req, p)
 }
 
+// The logout body is optional, so an empty request decodes to no refresh token.
+func (l *logout) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	if req.ContentLength == 0 {
+		return nil
+	}
+	return decodeRequest(w, req, l)
+}
+
+func (p *passwordResetRequest) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, p)
+}
+
+func (p *passwordResetConfirm) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, p)
+}
+
+func (t *totpCode) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, t)
+}
+
+func (t *totpLogin) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, t)
+}
+
+func (a *apiTokenRequest) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, a)
+}
+
+func (p *profileUpdate) decodeRequest(w http.ResponseWriter, req *http.Request) error {
+	return decodeRequest(w, req, p)
+}
+
 func (u *upgrade) decodeRequest(w http.ResponseWriter, req *http.Request) error {
 	return decodeRequest(w, req, u)
 }
@@ -78,6 +149,29 @@ func responseWithJson(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(dat)
 }
 
+// checkPassword enforces the password policy. A rejected password gets a 400
+// response listing every rule it failed.
+func checkPassword(w http.ResponseWriter, password, email string) bool {
+	err := auth.DefaultPasswordPolicy.Check(password, email)
+	if err == nil {
+		return true
+	}
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	type returnVals struct {
+		Error      string                 `json:"error"`
+		Violations []auth.PolicyViolation `json:"violations"`
+	}
+	responseWithJson(w, http.StatusBadRequest, returnVals{
+		Error:      policyErr.Error(),
+		Violations: policyErr.Violations,
+	})
+	return false
+}
+
 func (cfg *apiConfig) getUserByEmail(email string, r *http.Request) (*database.User, error) {
 	if user, err := cfg.dB.GetUserByEmail(r.Context(), email); err != nil {
 		return nil, fmt.Errorf("could not get user by email: %w", err)
@@ -85,3 +179,102 @@ func (cfg *apiConfig) getUserByEmail(email string, r *http.Request) (*database.U
 		return &user, nil
 	}
 }
+
+// authenticate returns the id of the user named by the request's bearer access token.
+// Personal access tokens are not accepted, so they cannot manage the account.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	_, userId, err := cfg.accessClaims(r)
+	return userId, err
+}
+
+// errMissingScope is returned by authorize when the token was not granted the
+// scope the route needs.
+var errMissingScope = errors.New("token lacks the required scope")
+
+// authorize returns the id of the user named by the request's bearer access
+// token or personal access token, provided the token was granted scope.
+func (cfg *apiConfig) authorize(r *http.Request, scope string) (uuid.UUID, error) {
+	access, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("no access token: %w", err)
+	}
+	var claims *auth.Claims
+	var userId uuid.UUID
+	if auth.IsPersonalToken(access) {
+		claims, userId, err = cfg.personalTokenClaims(r.Context(), access)
+	} else {
+		claims, userId, err = cfg.accessClaims(r)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !claims.HasScope(scope) {
+		return uuid.Nil, fmt.Errorf("%w %s", errMissingScope, scope)
+	}
+	return userId, nil
+}
+
+// respondAuthError responds to a request that authorize or authenticate
+// turned away.
+func respondAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMissingScope) {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+}
+
+// accessClaims validates the request's bearer access token, rejecting revoked
+// tokens, and returns its claims along with the user it was issued to.
+func (cfg *apiConfig) accessClaims(r *http.Request) (*auth.Claims, uuid.UUID, error) {
+	access, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("no access token: %w", err)
+	}
+	claims, err := auth.ParseJWT(access, cfg.tokens)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("could not validate user: %w", err)
+	}
+	userId, err := auth.SubjectID(claims)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("could not validate user: %w", err)
+	}
+	if err := cfg.checkRevoked(claims, userId); err != nil {
+		return nil, uuid.Nil, err
+	}
+	return claims, userId, nil
+}
+
+// optionalViewer returns the signed in user when the request carries a valid
+// access token with the chirps:read scope. Anonymous requests, and requests with a bad token, get no viewer.
+func (cfg *apiConfig) optionalViewer(r *http.Request) uuid.NullUUID {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}
+	}
+	userId, err := cfg.authorize(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userId, Valid: true}
+}
+
+// clientIP returns the address of the client that sent the request. The
+// X-Forwarded-For header is only trusted when the server runs behind a proxy,
+// and then only its last entry, which the proxy appended. Earlier entries
+// come from the client and can say anything.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+		if i := strings.LastIndex(forwarded, ","); i >= 0 {
+			forwarded = forwarded[i+1:]
+		}
+		if client := strings.TrimSpace(forwarded); client != "" {
+			return client
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
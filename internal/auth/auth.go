@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -10,7 +11,6 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func GetAPIKey(headers http.Header) (string, error) {
@@ -18,7 +18,7 @@ func GetAPIKey(headers http.Header) (string, error) {
 		return "", fmt.Errorf("authorization header not found")
 	} else {
 		tokenString := strings.Split(bearer, " ")
-		if len(tokenString) < 1 {
+		if len(tokenString) != 2 {
 			return "", fmt.Errorf("no api key found")
 		}
 		if strings.ToLower(tokenString[0]) != "apikey" {
@@ -35,48 +35,54 @@ func MakeRefreshToken() string {
 	return hexString
 }
 
-func HashPassword(pass string) (string, error) {
-	pword, err := bcrypt.GenerateFromPassword([]byte(pass), 10)
-	if err != nil {
-		return "", fmt.Errorf("could not hash pass: %w", err)
-	}
-
-	return string(pword[:]), nil
+// HashToken returns the hex encoded SHA-256 digest of a random token. Tokens
+// are stored by digest so a database leak does not expose live credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func CheckPasswordHash(password, hash string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return fmt.Errorf("password and hash do not match: %w", err)
+// MakeJWT signs an access token carrying claims. The issuer and audience
+// come from config, and the issue time, expiry and a unique jti are set here.
+func MakeJWT(claims Claims, config TokenConfig, expiresIn time.Duration) (string, error) {
+	now := time.Now().Truncate(timePrecision)
+	claims.Issuer = config.Issuer
+	if config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{config.Audience}
 	}
-	return nil
-}
-
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   fmt.Sprintf("%v", userID),
-	})
-	jwt, err := token.SignedString([]byte(tokenSecret))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+	claims.ID = uuid.NewString()
+	jwt, err := config.Keys.sign(claims, accessTokenType)
 	if err != nil {
 		return "", fmt.Errorf("could not sign token: %w", err)
 	}
 	return jwt, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
-		}
-		return []byte(tokenSecret), nil
-	})
+// ParseJWT verifies an access token against config and returns its claims,
+// including the jti (ID) and issue time needed to check whether it has been
+// revoked.
+func ParseJWT(tokenString string, config TokenConfig) (*Claims, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, config.keyFunc(accessTokenType), config.parserOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse: %w", err)
+	}
+	return &claims, nil
+}
+
+func ValidateJWT(tokenString string, config TokenConfig) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, config)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("could not parse: %w", err)
+		return uuid.Nil, err
 	}
-	uuidString, err := token.Claims.GetSubject()
+	return SubjectID(claims)
+}
+
+// SubjectID returns the user id held in the sub claim.
+func SubjectID(claims *Claims) (uuid.UUID, error) {
+	uuidString, err := claims.GetSubject()
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("could not get subject: %w", err)
 	}
@@ -87,12 +93,17 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// GetBearerToken returns the token from an "Authorization: Bearer <token>"
+// header. Any other form of the header is an error.
 func GetBearerToken(headers http.Header) (string, error) {
 	if bearer := headers.Get("Authorization"); bearer == "" {
 		return "", fmt.Errorf("authorization header not found")
 	} else {
 		tokenString := strings.Split(bearer, " ")
-		if len(tokenString) < 1 {
+		if len(tokenString) != 2 || tokenString[1] == "" {
+			return "", fmt.Errorf("no bearer token found")
+		}
+		if strings.ToLower(tokenString[0]) != "bearer" {
 			return "", fmt.Errorf("no bearer token found")
 		}
 		return tokenString[1], nil
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -46,7 +47,7 @@ func TestValidateJWT(t *testing.T) {
 		want      bool
 	}{
 		{"validation works", "10m", "thistestworks", "thistestworks", "f1e7d154-05fe-4dae-babd-e805734fe71b", true},
-		{"expired key", "1ms", "thistestexpires", "thistestexpires", "f1e7d154-05fe-4dae-babd-e805734fe71b", false},
+		{"expired key", "-1ms", "thistestexpires", "thistestexpires", "f1e7d154-05fe-4dae-babd-e805734fe71b", false},
 		{"wrong secret key", "10m", "correctKey", "wrongKey", "f1e7d154-05fe-4dae-babd-e805734fe71b", false},
 	}
 	for _, test := range tests {
@@ -59,11 +60,11 @@ func TestValidateJWT(t *testing.T) {
 			if err != nil {
 				t.Errorf("uuid not parsed")
 			}
-			jwtStr, err := MakeJWT(id, test.secretKey, duration)
+			jwtStr, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: NewKeySet(test.secretKey)}, duration)
 			if err != nil {
 				t.Errorf("jwtString not made")
 			}
-			rightID, err := ValidateJWT(jwtStr, test.fakeKey)
+			rightID, err := ValidateJWT(jwtStr, TokenConfig{Keys: NewKeySet(test.fakeKey)})
 			if (err != nil) == test.want {
 				t.Errorf("could not validate jwt: %s", err)
 			}
@@ -84,6 +85,10 @@ func TestGetBearerToken(t *testing.T) {
 	}{
 		{"header works", "Authorization", "Bearer tokenstring", true},
 		{"header not there", "Authorization", "", false},
+		{"no space", "Authorization", "tokenstring", false},
+		{"no token", "Authorization", "Bearer ", false},
+		{"wrong scheme", "Authorization", "ApiKey tokenstring", false},
+		{"extra field", "Authorization", "Bearer token string", false},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -94,10 +99,214 @@ func TestGetBearerToken(t *testing.T) {
 			if (err != nil) == test.want {
 				t.Errorf("could not get bearer token")
 			}
-			if len(tokenString) > 1 {
-				if (testVal != tokenString[1]) == test.want {
-					t.Errorf("%v does not equal %v to equal %v", testVal, tokenString[1], test.want)
-				}
+			if test.want && testVal != tokenString[1] {
+				t.Errorf("%v does not equal %v", testVal, tokenString[1])
+			}
+			if !test.want && testVal != "" {
+				t.Errorf("got token %v from %q", testVal, test.headerValue)
+			}
+		})
+	}
+}
+
+func TestIssuedBefore(t *testing.T) {
+	revokedAt := time.Date(2025, 4, 18, 12, 0, 0, 400_123_000, time.UTC)
+	cutoff := RevocationCutoff(revokedAt)
+	var tests = []struct {
+		name     string
+		issuedAt *jwt.NumericDate
+		want     bool
+	}{
+		{"earlier second", jwt.NewNumericDate(revokedAt.Add(-time.Second)), true},
+		{"same second before the cutoff", jwt.NewNumericDate(revokedAt.Add(-100 * time.Millisecond)), true},
+		{"same millisecond before the cutoff", jwt.NewNumericDate(revokedAt), true},
+		{"same second after the cutoff", jwt.NewNumericDate(revokedAt.Add(100 * time.Millisecond)), false},
+		{"later second", jwt.NewNumericDate(revokedAt.Add(time.Second)), false},
+		{"no issue time", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := Claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: test.issuedAt}}
+			if got := claims.IssuedBefore(cutoff); got != test.want {
+				t.Errorf("IssuedBefore(%v) = %v, want %v", cutoff, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoginAfterCutoff(t *testing.T) {
+	config := TokenConfig{Keys: NewKeySet("thistestworks")}
+	id := uuid.New()
+	before, err := MakeJWT(NewClaims(id, false), config, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	cutoff := RevocationCutoff(time.Now())
+	time.Sleep(time.Until(cutoff))
+	after, err := MakeJWT(NewClaims(id, false), config, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	beforeClaims, err := ParseJWT(before, config)
+	if err != nil {
+		t.Fatalf("could not parse jwt: %s", err)
+	}
+	afterClaims, err := ParseJWT(after, config)
+	if err != nil {
+		t.Fatalf("could not parse jwt: %s", err)
+	}
+	if !beforeClaims.IssuedBefore(cutoff) {
+		t.Errorf("token issued before the cutoff at %v is accepted", cutoff)
+	}
+	// almost always the same second as the cutoff, which whole second iat
+	// claims could not tell apart
+	if afterClaims.IssuedBefore(cutoff) {
+		t.Errorf("token issued at %v after the cutoff at %v is rejected", afterClaims.IssuedAt.Time, cutoff)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token := MakeRefreshToken()
+	hash := HashToken(token)
+	if hash == token {
+		t.Errorf("hash is the same as the token")
+	}
+	if len(hash) != 64 {
+		t.Errorf("hash %s is not a hex encoded SHA-256 digest", hash)
+	}
+	if HashToken(token) != hash {
+		t.Errorf("hashing the same token twice gave different digests")
+	}
+	if HashToken(MakeRefreshToken()) == hash {
+		t.Errorf("different tokens have the same digest")
+	}
+	// digest of "abc" from FIPS 180-2
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken(abc) = %s", got)
+	}
+}
+
+func TestParseJWT(t *testing.T) {
+	id := uuid.New()
+	keys := NewKeySet("thistestworks")
+	first, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: keys}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	second, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: keys}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	firstClaims, err := ParseJWT(first, TokenConfig{Keys: keys})
+	if err != nil {
+		t.Fatalf("could not parse jwt: %s", err)
+	}
+	secondClaims, err := ParseJWT(second, TokenConfig{Keys: keys})
+	if err != nil {
+		t.Fatalf("could not parse jwt: %s", err)
+	}
+	if _, err := uuid.Parse(firstClaims.ID); err != nil {
+		t.Errorf("jti %q is not a uuid: %s", firstClaims.ID, err)
+	}
+	if firstClaims.ID == secondClaims.ID {
+		t.Errorf("two tokens share the jti %s", firstClaims.ID)
+	}
+	if firstClaims.IssuedAt == nil || firstClaims.ExpiresAt == nil {
+		t.Errorf("token is missing iat or exp")
+	}
+	subject, err := SubjectID(firstClaims)
+	if err != nil || subject != id {
+		t.Errorf("subject %v does not match %v: %v", subject, id, err)
+	}
+	if _, err := ParseJWT(first, TokenConfig{Keys: NewKeySet("wrongKey")}); err == nil {
+		t.Errorf("token validated with the wrong key")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	config := TokenConfig{Keys: NewKeySet("thistestworks"), Issuer: "chirpy", Audience: "chirpy-api"}
+	id := uuid.New()
+	tokenString, err := MakeJWT(NewClaims(id, true, ScopeChirpsRead), config, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	claims, err := ParseJWT(tokenString, config)
+	if err != nil {
+		t.Fatalf("could not parse jwt: %s", err)
+	}
+	if claims.Issuer != "chirpy" || len(claims.Audience) != 1 || claims.Audience[0] != "chirpy-api" {
+		t.Errorf("iss = %q, aud = %v", claims.Issuer, claims.Audience)
+	}
+	if !claims.IsChirpyRed {
+		t.Errorf("is_chirpy_red was lost")
+	}
+	if !claims.HasScope(ScopeChirpsRead) || claims.HasScope(ScopeChirpsWrite) {
+		t.Errorf("scopes = %v, want only %s", claims.Scopes, ScopeChirpsRead)
+	}
+}
+
+func TestParseJWTRejects(t *testing.T) {
+	keys := NewKeySet("thistestworks")
+	config := TokenConfig{Keys: keys, Issuer: "chirpy", Audience: "chirpy-api", Leeway: 30 * time.Second}
+	now := time.Now()
+	valid := func() Claims {
+		return Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{"chirpy-api"},
+			Subject:   uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}}
+	}
+	var tests = []struct {
+		name   string
+		modify func(c *Claims)
+		want   bool
+	}{
+		{"valid", func(c *Claims) {}, true},
+		{"wrong issuer", func(c *Claims) { c.Issuer = "someone-else" }, false},
+		{"missing issuer", func(c *Claims) { c.Issuer = "" }, false},
+		{"wrong audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api"} }, false},
+		{"missing audience", func(c *Claims) { c.Audience = nil }, false},
+		{"one of several audiences", func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api", "chirpy-api"} }, true},
+		{"missing expiry", func(c *Claims) { c.ExpiresAt = nil }, false},
+		{"expired within leeway", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }, true},
+		{"expired beyond leeway", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, false},
+		{"issued in the future within leeway", func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(10 * time.Second)) }, true},
+		{"issued in the future beyond leeway", func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }, false},
+		{"not yet valid", func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid()
+			test.modify(&claims)
+			tokenString, err := keys.sign(claims, accessTokenType)
+			if err != nil {
+				t.Fatalf("could not sign token: %s", err)
+			}
+			_, err = ParseJWT(tokenString, config)
+			if (err == nil) != test.want {
+				t.Errorf("ParseJWT error = %v, want valid %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSubjectID(t *testing.T) {
+	var tests = []struct {
+		name    string
+		subject string
+		want    bool
+	}{
+		{"uuid subject", uuid.NewString(), true},
+		{"missing subject", "", false},
+		{"not a uuid", "chirpy-user", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: test.subject}}
+			if _, err := SubjectID(&claims); (err == nil) != test.want {
+				t.Errorf("SubjectID(%q) error = %v, want valid %v", test.subject, err, test.want)
 			}
 		})
 	}
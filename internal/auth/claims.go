@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Scopes limit what an access token may be used for.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// UserScopes are granted to tokens issued when a user logs in.
+var UserScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// timePrecision is the precision of the issue time of the access tokens this
+// package issues. Whole seconds are too coarse to tell a token issued just
+// after a revocation cutoff from one issued just before it.
+const timePrecision = time.Millisecond
+
+func init() {
+	// Times are parsed through a float64, which can land just below the
+	// written value; the jwt package then truncates to TimePrecision. Keeping
+	// that finer than timePrecision lets IssuedBefore round the error away.
+	jwt.TimePrecision = time.Microsecond
+}
+
+// Claims are the claims carried by a Chirpy access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scopes      []string `json:"scopes,omitempty"`
+	IsChirpyRed bool     `json:"is_chirpy_red"`
+}
+
+// NewClaims returns the claims of an access token for userID. MakeJWT fills
+// in the issuer, audience and lifetime.
+func NewClaims(userID uuid.UUID, isChirpyRed bool, scopes ...string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: userID.String()},
+		Scopes:           scopes,
+		IsChirpyRed:      isChirpyRed,
+	}
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// RevocationCutoff returns the cutoff that revokes every token issued up to
+// t: t rounded up to the precision of iat, so that a token issued before t
+// never compares equal to it.
+func RevocationCutoff(t time.Time) time.Time {
+	cutoff := t.Truncate(timePrecision)
+	if cutoff.Before(t) {
+		cutoff = cutoff.Add(timePrecision)
+	}
+	return cutoff
+}
+
+// IssuedBefore reports whether the token was issued before cutoff. A token
+// without an issue time is treated as issued before any cutoff. The parsed
+// iat can come back a microsecond early, so it is rounded to its precision
+// first.
+func (c *Claims) IssuedBefore(cutoff time.Time) bool {
+	return c.IssuedAt == nil || c.IssuedAt.Time.Round(timePrecision).Before(cutoff)
+}
+
+// TokenConfig describes the access tokens this server issues and accepts.
+// Tokens are issued with Issuer and Audience, and validation rejects tokens
+// that do not carry them; an empty value is neither set nor checked. Leeway
+// allows for clock skew between servers when checking exp, nbf and iat.
+type TokenConfig struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Token types, carried in the typ header.
+const (
+	accessTokenType            = "JWT"
+	emailVerificationTokenType = "email-verification+jwt"
+)
+
+// keyFunc verifies tokens of type typ only.
+func (config TokenConfig) keyFunc(typ string) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if got, _ := token.Header["typ"].(string); got != typ {
+			return nil, fmt.Errorf("unexpected token type %q", got)
+		}
+		return config.Keys.keyFunc(token)
+	}
+}
+
+func (config TokenConfig) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	return options
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// signingKey is one key from the key directory. Keys that only have a public
+// half can verify tokens but never sign them.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify our JWTs. Each PEM file
+// in the key directory is one key, named by its file name, which becomes the
+// kid header of the tokens it signs. The private key whose name sorts last
+// signs new tokens, and every key keeps verifying until its file is removed,
+// so keys can be rotated without logging anyone out.
+//
+// When a secret is set, HS256 tokens are still accepted, and they are issued
+// when the directory holds no private keys.
+type KeySet struct {
+	dir    string
+	secret []byte
+
+	mu     sync.RWMutex
+	keys   map[string]*signingKey
+	signer *signingKey
+}
+
+// NewKeySet returns a key set that signs and verifies HS256 tokens with secret.
+func NewKeySet(secret string) *KeySet {
+	return &KeySet{
+		secret: []byte(secret),
+		keys:   map[string]*signingKey{},
+	}
+}
+
+// LoadKeySet loads the keys in dir. An empty dir loads no keys, leaving only
+// the HS256 secret.
+func LoadKeySet(dir, secret string) (*KeySet, error) {
+	ks := NewKeySet(secret)
+	ks.dir = dir
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload reads the key directory again. On failure the current keys are kept.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("could not list keys: %w", err)
+	}
+	sort.Strings(paths)
+	keys := map[string]*signingKey{}
+	var signer *signingKey
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return err
+		}
+		keys[key.id] = key
+		if key.private != nil {
+			signer = key
+		}
+	}
+	if signer == nil && len(ks.secret) == 0 {
+		return fmt.Errorf("no signing key in %s and no secret set", ks.dir)
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.signer = signer
+	return nil
+}
+
+func loadKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a signing key", path)
+		}
+		key.private = signer
+		key.public = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		key.private = parsed
+		key.public = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		key.public = parsed
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported %q block", path, block.Type)
+	}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%s is shorter than %d bits", path, minRSABits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s is not an RSA or Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// sign signs claims with the current signing key, or with the HS256 secret
+// when there is none. typ goes in the header so one kind of token cannot be
+// passed off as another.
+func (ks *KeySet) sign(claims jwt.Claims, typ string) (string, error) {
+	ks.mu.RLock()
+	signer := ks.signer
+	ks.mu.RUnlock()
+	if signer == nil {
+		if len(ks.secret) == 0 {
+			return "", fmt.Errorf("no signing key")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["typ"] = typ
+		return token.SignedString(ks.secret)
+	}
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = signer.id
+	return token.SignedString(signer.private)
+}
+
+// keyFunc picks the key that verifies token. Asymmetric tokens are looked up
+// by kid and must use that key's algorithm; HS256 tokens need the secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(ks.secret) == 0 {
+			return nil, fmt.Errorf("HS256 tokens are not accepted")
+		}
+		return ks.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is the public half of a signing key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every asymmetric key, sorted by kid. The
+// HS256 secret is never published.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{
+			Use: "sig",
+			Alg: key.method.Alg(),
+			Kid: key.id,
+		}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePrivateKey(t *testing.T, dir, name string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %s", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), data, 0o600); err != nil {
+		t.Fatalf("could not write key: %s", err)
+	}
+}
+
+func writePublicKey(t *testing.T, dir, name string, key crypto.PublicKey) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %s", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), data, 0o600); err != nil {
+		t.Fatalf("could not write key: %s", err)
+	}
+}
+
+func tokenHeader(t *testing.T, tokenString string) map[string]interface{} {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("could not parse token: %s", err)
+	}
+	return token.Header
+}
+
+func TestKeySetSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %s", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ed25519 key: %s", err)
+	}
+	var tests = []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"rsa key", rsaKey, "RS256"},
+		{"ed25519 key", edKey, "EdDSA"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrivateKey(t, dir, "2025-04-13", test.key)
+			keys, err := LoadKeySet(dir, "")
+			if err != nil {
+				t.Fatalf("could not load keys: %s", err)
+			}
+			id := uuid.New()
+			tokenString, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: keys}, time.Minute)
+			if err != nil {
+				t.Fatalf("could not make jwt: %s", err)
+			}
+			header := tokenHeader(t, tokenString)
+			if header["alg"] != test.alg || header["kid"] != "2025-04-13" {
+				t.Errorf("header = %v, want alg %s and kid 2025-04-13", header, test.alg)
+			}
+			got, err := ValidateJWT(tokenString, TokenConfig{Keys: keys})
+			if err != nil || got != id {
+				t.Errorf("ValidateJWT = %v, %v, want %v", got, err, id)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "2025-04-01", oldKey)
+	keys, err := LoadKeySet(dir, "legacysecret")
+	if err != nil {
+		t.Fatalf("could not load keys: %s", err)
+	}
+	id := uuid.New()
+	oldToken, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: keys}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	legacyToken, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: NewKeySet("legacysecret")}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+
+	// rotate: the new key signs, the old one is kept for verification only
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "2025-04-13", newKey)
+	writePublicKey(t, dir, "2025-04-01", oldKey.Public())
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("could not reload keys: %s", err)
+	}
+	newToken, err := MakeJWT(NewClaims(id, false), TokenConfig{Keys: keys}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	if kid := tokenHeader(t, newToken)["kid"]; kid != "2025-04-13" {
+		t.Errorf("new token signed by %v, want 2025-04-13", kid)
+	}
+	for name, tokenString := range map[string]string{"old key": oldToken, "new key": newToken, "hs256": legacyToken} {
+		if _, err := ValidateJWT(tokenString, TokenConfig{Keys: keys}); err != nil {
+			t.Errorf("%s token rejected: %s", name, err)
+		}
+	}
+
+	// retire the old key
+	if err := os.Remove(filepath.Join(dir, "2025-04-01.pem")); err != nil {
+		t.Fatalf("could not remove key: %s", err)
+	}
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("could not reload keys: %s", err)
+	}
+	if _, err := ValidateJWT(oldToken, TokenConfig{Keys: keys}); err == nil {
+		t.Errorf("token signed by a retired key was accepted")
+	}
+	if _, err := ValidateJWT(legacyToken, TokenConfig{Keys: NewKeySet("")}); err == nil {
+		t.Errorf("hs256 token accepted without a secret")
+	}
+}
+
+func TestKeySetRejects(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "current", edKey)
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("could not load keys: %s", err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	claims := jwt.RegisteredClaims{
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+	sign := func(kid string, key crypto.Signer) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("could not sign token: %s", err)
+		}
+		return tokenString
+	}
+	var tests = []struct {
+		name  string
+		token string
+	}{
+		{"no kid", sign("", edKey)},
+		{"unknown kid", sign("missing", edKey)},
+		{"wrong key for kid", sign("current", otherKey)},
+		{"unsigned", func() string {
+			s, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return s
+		}()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ValidateJWT(test.token, TokenConfig{Keys: keys}); err == nil {
+				t.Errorf("token was accepted")
+			}
+		})
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %s", err)
+	}
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	var tests = []struct {
+		name  string
+		setup func(dir string)
+	}{
+		{"short rsa key", func(dir string) { writePrivateKey(t, dir, "small", smallKey) }},
+		{"not pem", func(dir string) { os.WriteFile(filepath.Join(dir, "junk.pem"), []byte("junk"), 0o600) }},
+		{"only public keys", func(dir string) { writePublicKey(t, dir, "public", edKey.Public()) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			test.setup(dir)
+			if _, err := LoadKeySet(dir, ""); err == nil {
+				t.Errorf("expected LoadKeySet to fail")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %s", err)
+	}
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "a-rsa", rsaKey)
+	writePrivateKey(t, dir, "b-ed25519", edKey)
+	keys, err := LoadKeySet(dir, "neverpublished")
+	if err != nil {
+		t.Fatalf("could not load keys: %s", err)
+	}
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(set.Keys))
+	}
+	rsaJWK, edJWK := set.Keys[0], set.Keys[1]
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.Kid != "a-rsa" || rsaJWK.E != "AQAB" || rsaJWK.N == "" {
+		t.Errorf("unexpected rsa jwk %+v", rsaJWK)
+	}
+	if edJWK.Kty != "OKP" || edJWK.Crv != "Ed25519" || edJWK.Alg != "EdDSA" || edJWK.Kid != "b-ed25519" {
+		t.Errorf("unexpected ed25519 jwk %+v", edJWK)
+	}
+	if edJWK.X != base64.RawURLEncoding.EncodeToString(edPublic) {
+		t.Errorf("ed25519 jwk x = %s does not match the public key", edJWK.X)
+	}
+	if len(NewKeySet("secret").JWKS().Keys) != 0 {
+		t.Errorf("hs256 secret was published")
+	}
+}
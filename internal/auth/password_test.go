@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	var tests = []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{"bcrypt", BcryptHasher{Cost: 4}, "$2a$04$"},
+		{"argon2id", Argon2idHasher{Memory: 64, Time: 1, Threads: 1}, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := test.hasher.Hash("thisisatestpassword")
+			if err != nil {
+				t.Fatalf("could not hash password: %s", err)
+			}
+			if !strings.HasPrefix(hash, test.prefix) {
+				t.Errorf("hash %s does not start with %s", hash, test.prefix)
+			}
+			if err := CheckPasswordHash("thisisatestpassword", hash); err != nil {
+				t.Errorf("correct password rejected: %s", err)
+			}
+			if err := CheckPasswordHash("ThisIsATestPassword", hash); err == nil {
+				t.Errorf("wrong password accepted")
+			}
+			if test.hasher.NeedsRehash(hash) {
+				t.Errorf("fresh hash needs a rehash")
+			}
+			again, _ := test.hasher.Hash("thisisatestpassword")
+			if again == hash {
+				t.Errorf("two hashes of the same password are identical")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := BcryptHasher{Cost: 4}.Hash("thisisatestpassword")
+	if err != nil {
+		t.Fatalf("could not hash password: %s", err)
+	}
+	argonHash, err := Argon2idHasher{Memory: 64, Time: 1, Threads: 1}.Hash("thisisatestpassword")
+	if err != nil {
+		t.Fatalf("could not hash password: %s", err)
+	}
+	var tests = []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"same bcrypt cost", BcryptHasher{Cost: 4}, bcryptHash, false},
+		{"higher bcrypt cost", BcryptHasher{Cost: 5}, bcryptHash, true},
+		{"bcrypt to argon2id", Argon2idHasher{Memory: 64, Time: 1, Threads: 1}, bcryptHash, true},
+		{"same argon2id parameters", Argon2idHasher{Memory: 64, Time: 1, Threads: 1}, argonHash, false},
+		{"more argon2id memory", Argon2idHasher{Memory: 128, Time: 1, Threads: 1}, argonHash, true},
+		{"more argon2id passes", Argon2idHasher{Memory: 64, Time: 2, Threads: 1}, argonHash, true},
+		{"argon2id to bcrypt", BcryptHasher{Cost: 4}, argonHash, true},
+		{"garbage", BcryptHasher{Cost: 4}, "not a hash", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.hash); got != test.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordHashMalformed(t *testing.T) {
+	var tests = []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"missing parameters", "$argon2id$v=19$$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5"},
+		{"missing key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := CheckPasswordHash("thisisatestpassword", test.hash); err == nil {
+				t.Errorf("malformed hash %q accepted", test.hash)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	var tests = []struct {
+		name      string
+		algorithm string
+		cost      int
+		want      bool
+	}{
+		{"default", "", 10, true},
+		{"bcrypt", "bcrypt", 12, true},
+		{"bcrypt cost too low", "bcrypt", 2, false},
+		{"bcrypt cost too high", "bcrypt", 40, false},
+		{"argon2id", "argon2id", 0, true},
+		{"unknown", "md5", 10, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewPasswordHasher(test.algorithm, test.cost)
+			if (err == nil) != test.want {
+				t.Errorf("NewPasswordHasher(%q, %d) error = %v", test.algorithm, test.cost, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PersonalTokenPrefix starts every personal access token, so they can be told
+// apart from JWTs in the Authorization header and spotted by secret scanners.
+const PersonalTokenPrefix = "chirpy_pat_"
+
+// MakePersonalToken returns a new random personal access token. Like refresh
+// tokens, only its HashToken digest should be stored.
+func MakePersonalToken() string {
+	return PersonalTokenPrefix + MakeRefreshToken()
+}
+
+// IsPersonalToken reports whether token looks like a personal access token.
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+// CheckScopes returns an error unless scopes names at least one scope and only
+// scopes a user may grant.
+func CheckScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(UserScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
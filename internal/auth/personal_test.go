@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakePersonalToken(t *testing.T) {
+	token := MakePersonalToken()
+	if !IsPersonalToken(token) {
+		t.Errorf("%s is not recognised as a personal token", token)
+	}
+	if len(strings.TrimPrefix(token, PersonalTokenPrefix)) != 64 {
+		t.Errorf("%s does not carry 32 random bytes", token)
+	}
+	if MakePersonalToken() == token {
+		t.Errorf("two tokens are identical")
+	}
+	if IsPersonalToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Errorf("a JWT is recognised as a personal token")
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	var tests = []struct {
+		name   string
+		scopes []string
+		valid  bool
+	}{
+		{"one scope", []string{ScopeChirpsRead}, true},
+		{"every scope", UserScopes, true},
+		{"no scopes", nil, false},
+		{"unknown scope", []string{ScopeChirpsRead, "admin"}, false},
+		{"empty scope", []string{""}, false},
+	}
+	for _, test := range tests {
+		if err := CheckScopes(test.scopes); (err == nil) != test.valid {
+			t.Errorf("%s: CheckScopes(%v) = %v, want valid %v", test.name, test.scopes, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// Rules a password can break.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxBytes  = "max_bytes"
+	RuleNotEmail  = "not_email"
+	RuleNotCommon = "not_common"
+)
+
+// PolicyViolation is one rule a password failed.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password failed, so the user can
+// fix them all at once.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// PasswordPolicy decides which passwords users may choose. MinLength counts
+// characters; MaxBytes exists because bcrypt ignores everything after the
+// 72nd byte, so a longer password is weaker than it looks.
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+	Blocklist map[string]bool
+}
+
+// DefaultPasswordPolicy requires 8 to 72 bytes and rejects the passwords in
+// common_passwords.txt.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxBytes:  72,
+	Blocklist: ParseBlocklist(commonPasswordsFile),
+}
+
+// ParseBlocklist reads one password per line, skipping blank lines and
+// comments starting with #.
+func ParseBlocklist(list string) map[string]bool {
+	blocklist := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = true
+	}
+	return blocklist
+}
+
+// Check returns a *PasswordPolicyError when password breaks any rule for
+// the account with the given email.
+func (p PasswordPolicy) Check(password, email string) error {
+	var violations []PolicyViolation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if len(password) > p.MaxBytes {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxBytes,
+			Message: fmt.Sprintf("password must be at most %d bytes", p.MaxBytes),
+		})
+	}
+	if matchesEmail(password, email) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleNotEmail,
+			Message: "password must not match the email address",
+		})
+	}
+	if p.Blocklist[strings.ToLower(password)] {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleNotCommon,
+			Message: "password is too common",
+		})
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// matchesEmail reports whether password is the email address or its local
+// part, ignoring case.
+func matchesEmail(password, email string) bool {
+	if password == "" || email == "" {
+		return false
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return strings.EqualFold(password, email) || strings.EqualFold(password, local)
+}
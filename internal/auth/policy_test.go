@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	var tests = []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"acceptable", "correct horse battery", "walt@example.com", nil},
+		{"empty", "", "walt@example.com", []string{RuleMinLength}},
+		{"too short", "k3rfuf!", "walt@example.com", []string{RuleMinLength}},
+		{"counts characters not bytes", "пароль12", "walt@example.com", nil},
+		{"exactly 72 bytes", strings.Repeat("x", 72), "walt@example.com", nil},
+		{"longer than 72 bytes", strings.Repeat("x", 73), "walt@example.com", []string{RuleMaxBytes}},
+		{"multibyte over 72 bytes", strings.Repeat("é", 37), "walt@example.com", []string{RuleMaxBytes}},
+		{"matches email", "Walt@Example.com", "walt@example.com", []string{RuleNotEmail}},
+		{"matches local part", "waltwhite", "waltwhite@example.com", []string{RuleNotEmail}},
+		{"common password", "Password123", "walt@example.com", []string{RuleNotCommon}},
+		{"several rules", "abc123", "abc123@example.com", []string{RuleMinLength, RuleNotEmail, RuleNotCommon}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := DefaultPasswordPolicy.Check(test.password, test.email)
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("Check(%q) = %v, want nil", test.password, err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check(%q) = %v, want a PasswordPolicyError", test.password, err)
+			}
+			var rules []string
+			for _, violation := range policyErr.Violations {
+				rules = append(rules, violation.Rule)
+				if violation.Message == "" {
+					t.Errorf("rule %s has no message", violation.Rule)
+				}
+			}
+			if !slices.Equal(rules, test.want) {
+				t.Errorf("Check(%q) broke %v, want %v", test.password, rules, test.want)
+			}
+		})
+	}
+}
+
+func TestParseBlocklist(t *testing.T) {
+	blocklist := ParseBlocklist("# comment\n\nHunter2\n  letmein  \n")
+	if len(blocklist) != 2 || !blocklist["hunter2"] || !blocklist["letmein"] {
+		t.Errorf("ParseBlocklist = %v", blocklist)
+	}
+	if len(DefaultPasswordPolicy.Blocklist) == 0 {
+		t.Errorf("embedded blocklist is empty")
+	}
+}
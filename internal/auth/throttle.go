@@ -0,0 +1,37 @@
+package auth
+
+import "time"
+
+// Backoff decides how long logins are locked out after repeated failures.
+// The first Free failures cost nothing; after that each failure doubles the
+// lockout, starting at Base and capped at Max. Failures older than Reset are
+// forgotten.
+type Backoff struct {
+	Free  int
+	Base  time.Duration
+	Max   time.Duration
+	Reset time.Duration
+}
+
+// Login backoffs for one account and for one client address. An address gets
+// more attempts, since many users can share one behind NAT.
+var (
+	AccountBackoff = Backoff{Free: 5, Base: 30 * time.Second, Max: 30 * time.Minute, Reset: 24 * time.Hour}
+	AddressBackoff = Backoff{Free: 20, Base: 10 * time.Second, Max: 30 * time.Minute, Reset: time.Hour}
+)
+
+// Lockout returns how long to refuse logins after failures consecutive
+// failed attempts.
+func (b Backoff) Lockout(failures int) time.Duration {
+	if failures < b.Free {
+		return 0
+	}
+	delay := b.Base
+	for i := b.Free; i < failures; i++ {
+		delay *= 2
+		if delay >= b.Max {
+			return b.Max
+		}
+	}
+	return min(delay, b.Max)
+}
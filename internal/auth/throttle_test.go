@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffLockout(t *testing.T) {
+	backoff := Backoff{Free: 3, Base: time.Second, Max: time.Minute}
+	var tests = []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{8, 32 * time.Second},
+		{9, time.Minute},
+		{100, time.Minute},
+	}
+	for _, test := range tests {
+		if got := backoff.Lockout(test.failures); got != test.want {
+			t.Errorf("Lockout(%d) = %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	for name, backoff := range map[string]Backoff{"account": AccountBackoff, "address": AddressBackoff} {
+		if backoff.Lockout(backoff.Free-1) != 0 {
+			t.Errorf("%s backoff locks out before %d failures", name, backoff.Free)
+		}
+		if backoff.Lockout(backoff.Free) <= 0 {
+			t.Errorf("%s backoff does not lock out after %d failures", name, backoff.Free)
+		}
+		if backoff.Lockout(1000) != backoff.Max {
+			t.Errorf("%s backoff is not capped at %s", name, backoff.Max)
+		}
+	}
+}
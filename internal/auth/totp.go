@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP settings (RFC 6238). These are the defaults every authenticator app
+// understands: HMAC-SHA1, six digits and a 30 second step.
+const (
+	totpDigits      = 6
+	totpPeriod      = 30 * time.Second
+	totpSecretBytes = 20
+	// totpSkew is how many steps a code may be early or late, to allow for
+	// clock drift and the time it takes to type the code.
+	totpSkew = 1
+	// A recovery code is 28 base32 characters carrying 136 random bits,
+	// written in groups of 7. That is too many to guess even offline, so a
+	// plain digest is enough if the database leaks.
+	recoveryCodeLength = 28
+	recoveryCodeGroup  = 7
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random secret, base32 encoded the way
+// authenticator apps expect it.
+func GenerateTOTPSecret() string {
+	secret := make([]byte, totpSecretBytes)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps read from a QR
+// code to add an account.
+func TOTPURI(secret, issuer, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode totp secret: %w", err)
+	}
+	return key, nil
+}
+
+// hotp computes an HOTP value (RFC 4226) for counter.
+func hotp(key []byte, counter uint64, digits int, h func() hash.Hash) string {
+	mac := hmac.New(h, key)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// TOTPCode returns the code for secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(totpStep(t)), totpDigits, sha1.New), nil
+}
+
+// ValidateTOTP checks code against secret at t and returns the time step it
+// matched. Callers should store the step and reject codes from the same or
+// an earlier step, so a code cannot be replayed.
+func ValidateTOTP(secret, code string, t time.Time) (int64, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	code = strings.TrimSpace(code)
+	current := totpStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		want := hotp(key, uint64(step), totpDigits, sha1.New)
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid totp code")
+}
+
+// GenerateRecoveryCodes returns n single use codes that stand in for a TOTP
+// code when the user has lost their authenticator, formatted like
+// "abcdefg-hijklmn-opqrstu-vwxyz23". Store them with HashRecoveryCode.
+func GenerateRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength*5/8)
+		rand.Read(raw)
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		groups := make([]string, 0, recoveryCodeLength/recoveryCodeGroup)
+		for start := 0; start < recoveryCodeLength; start += recoveryCodeGroup {
+			groups = append(groups, code[start:start+recoveryCodeGroup])
+		}
+		codes[i] = strings.Join(groups, "-")
+	}
+	return codes
+}
+
+// HashRecoveryCode returns the digest a recovery code is stored by. Case,
+// spaces and dashes are ignored, since users type the codes by hand.
+func HashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashToken(normalized)
+}
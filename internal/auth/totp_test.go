@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter), 6, sha1.New); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B
+	sha1Key := []byte("12345678901234567890")
+	sha256Key := []byte("12345678901234567890123456789012")
+	sha512Key := []byte("1234567890123456789012345678901234567890123456789012345678901234")
+	var tests = []struct {
+		unix   int64
+		sha1   string
+		sha256 string
+		sha512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1111111111, "14050471", "67062674", "99943326"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{2000000000, "69279037", "90698825", "38618901"},
+		{20000000000, "65353130", "77737706", "47863826"},
+	}
+	for _, test := range tests {
+		step := uint64(totpStep(time.Unix(test.unix, 0)))
+		if got := hotp(sha1Key, step, 8, sha1.New); got != test.sha1 {
+			t.Errorf("SHA1 at %d = %s, want %s", test.unix, got, test.sha1)
+		}
+		if got := hotp(sha256Key, step, 8, sha256.New); got != test.sha256 {
+			t.Errorf("SHA256 at %d = %s, want %s", test.unix, got, test.sha256)
+		}
+		if got := hotp(sha512Key, step, 8, sha512.New); got != test.sha512 {
+			t.Errorf("SHA512 at %d = %s, want %s", test.unix, got, test.sha512)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// base32 of the RFC 6238 SHA1 key
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111111, 0)
+	current, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("could not make code: %s", err)
+	}
+	if current != "050471" {
+		t.Errorf("TOTPCode = %s, want the last six digits of 14050471", current)
+	}
+	previous, _ := TOTPCode(secret, now.Add(-totpPeriod))
+	next, _ := TOTPCode(secret, now.Add(totpPeriod))
+	stale, _ := TOTPCode(secret, now.Add(-3*totpPeriod))
+	var tests = []struct {
+		name string
+		code string
+		step int64
+		want bool
+	}{
+		{"current code", current, totpStep(now), true},
+		{"code with spaces", " " + current + " ", totpStep(now), true},
+		{"previous code", previous, totpStep(now) - 1, true},
+		{"next code", next, totpStep(now) + 1, true},
+		{"stale code", stale, 0, false},
+		{"wrong code", "000000", 0, false},
+		{"empty code", "", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, err := ValidateTOTP(secret, test.code, now)
+			if (err == nil) != test.want {
+				t.Fatalf("ValidateTOTP(%q) error = %v, want valid %v", test.code, err, test.want)
+			}
+			if test.want && step != test.step {
+				t.Errorf("ValidateTOTP(%q) step = %d, want %d", test.code, step, test.step)
+			}
+		})
+	}
+	if _, err := ValidateTOTP("not base32!", current, now); err == nil {
+		t.Errorf("malformed secret accepted")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) != totpSecretBytes {
+		t.Errorf("secret %s decodes to %d bytes, %v", secret, len(key), err)
+	}
+	if GenerateTOTPSecret() == secret {
+		t.Errorf("two secrets are identical")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "walt@example.com")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("could not parse %s: %s", uri, err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Chirpy:walt@example.com" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "Chirpy" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("unexpected query %v", query)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(10)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		groups := strings.Split(code, "-")
+		if len(groups) != 4 || len(strings.Join(groups, "")) != 28 {
+			t.Errorf("code %q is not formatted like abcdefg-hijklmn-opqrstu-vwxyz23", code)
+		}
+		for _, group := range groups {
+			if len(group) != 7 {
+				t.Errorf("code %q has a group of %d characters", code, len(group))
+			}
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+	code := codes[0]
+	typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+	if HashRecoveryCode(typed) != HashRecoveryCode(code) {
+		t.Errorf("%q and %q hash differently", typed, code)
+	}
+	if HashRecoveryCode(codes[1]) == HashRecoveryCode(code) {
+		t.Errorf("different codes hash the same")
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	config := TokenConfig{Keys: NewKeySet("thistestworks"), Issuer: "chirpy", Audience: "chirpy"}
+	id := uuid.New()
+	token, issued, err := MakeEmailVerificationToken(id, "walt@example.com", config, time.Hour)
+	if err != nil {
+		t.Fatalf("could not make token: %s", err)
+	}
+	claims, err := ParseEmailVerificationToken(token, config)
+	if err != nil {
+		t.Fatalf("could not parse token: %s", err)
+	}
+	if claims.Email != "walt@example.com" || claims.ID != issued.ID {
+		t.Errorf("claims = %+v, want email walt@example.com and jti %s", claims, issued.ID)
+	}
+	if subject, err := SubjectID(&Claims{RegisteredClaims: claims.RegisteredClaims}); err != nil || subject != id {
+		t.Errorf("subject = %v, %v, want %v", subject, err, id)
+	}
+}
+
+func TestTokenTypesAreSeparate(t *testing.T) {
+	config := TokenConfig{Keys: NewKeySet("thistestworks"), Issuer: "chirpy", Audience: "chirpy"}
+	id := uuid.New()
+	verification, _, err := MakeEmailVerificationToken(id, "walt@example.com", config, time.Hour)
+	if err != nil {
+		t.Fatalf("could not make token: %s", err)
+	}
+	access, err := MakeJWT(NewClaims(id, false, UserScopes...), config, time.Hour)
+	if err != nil {
+		t.Fatalf("could not make jwt: %s", err)
+	}
+	if _, err := ParseJWT(verification, config); err == nil {
+		t.Errorf("verification token accepted as an access token")
+	}
+	if _, err := ParseEmailVerificationToken(access, config); err == nil {
+		t.Errorf("access token accepted as a verification token")
+	}
+	expired, _, _ := MakeEmailVerificationToken(id, "walt@example.com", config, -time.Hour)
+	if _, err := ParseEmailVerificationToken(expired, config); err == nil {
+		t.Errorf("expired verification token accepted")
+	}
+	if _, err := ParseEmailVerificationToken(verification, TokenConfig{Keys: NewKeySet("wrongKey")}); err == nil {
+		t.Errorf("verification token accepted with the wrong key")
+	}
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,7 +22,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -39,12 +40,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, email_verified_at FROM users
 WHERE email = $1
 `
 
@@ -58,6 +62,31 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, email_verified_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -73,9 +102,10 @@ func (q *Queries) RemoveUsers(ctx context.Context) error {
 
 const updateCreds = `-- name: UpdateCreds :one
 UPDATE users
-SET hashed_password = $1, email = $2, updated_at = NOW()
+SET hashed_password = $1, email = $2, updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, is_chirpy_red, email_verified_at
 `
 
 type UpdateCredsParams struct {
@@ -85,11 +115,12 @@ type UpdateCredsParams struct {
 }
 
 type UpdateCredsRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Email       string
-	IsChirpyRed bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	IsChirpyRed     bool
+	EmailVerifiedAt sql.NullTime
 }
 
 func (q *Queries) UpdateCreds(ctx context.Context, arg UpdateCredsParams) (UpdateCredsRow, error) {
@@ -101,10 +132,94 @@ func (q *Queries) UpdateCreds(ctx context.Context, arg UpdateCredsParams) (Updat
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updatePassword = `-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdatePasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updatePassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updatePasswordHash = `-- name: UpdatePasswordHash :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpdatePasswordHashParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updatePasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT users.id, users.created_at, users.is_chirpy_red, users.display_name, users.bio,
+    (
+        SELECT COUNT(*) FROM chirps
+        WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL
+    ) AS chirp_count
+FROM users
+WHERE users.id = $1
+`
+
+type GetUserProfileRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	IsChirpyRed bool
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	ChirpCount  int64
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, id uuid.UUID) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, id)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpCount,
 	)
 	return i, err
 }
 
+const updateProfile = `-- name: UpdateProfile :exec
+UPDATE users
+SET display_name = $1, bio = $2, updated_at = NOW()
+WHERE id = $3
+`
+
+type UpdateProfileParams struct {
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) error {
+	_, err := q.db.ExecContext(ctx, updateProfile, arg.DisplayName, arg.Bio, arg.ID)
+	return err
+}
+
 const upgradeUser = `-- name: UpgradeUser :exec
 UPDATE users
 SET is_chirpy_red = TRUE
@@ -115,3 +230,32 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, upgradeUser, id)
 	return err
 }
+
+const verifyEmail = `-- name: VerifyEmail :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, display_name, bio, email_verified_at
+`
+
+type VerifyEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyEmail(ctx context.Context, arg VerifyEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,109 @@
+// Package mail sends the emails Chirpy needs, such as address verification
+// links. Only local implementations exist for now: they print or save each
+// message so it can be read during development and testing.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer named by kind: "stdout" (the default) prints
+// messages, "file" saves each one under dir.
+func New(kind, from, dir string) (Mailer, error) {
+	switch kind {
+	case "", "stdout":
+		return NewWriterMailer(os.Stdout, from), nil
+	case "file":
+		if dir == "" {
+			return nil, fmt.Errorf("the file mailer needs a directory")
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("could not create mail directory: %w", err)
+		}
+		return &FileMailer{Dir: dir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", kind)
+	}
+}
+
+// format renders msg in Internet Message Format (RFC 5322).
+func format(from string, msg Message, date time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String()
+}
+
+// checkHeaders rejects header values that could inject extra headers.
+func checkHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("header contains a line break")
+	}
+	return nil
+}
+
+// WriterMailer writes every message to an io.Writer, one after another.
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, from: from}
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(m.w, "%s\r\n\r\n", format(m.from, msg, time.Now())); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+	return nil
+}
+
+// FileMailer saves every message as a separate .eml file in Dir.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405Z"), uuid.NewString())
+	if err := os.WriteFile(filepath.Join(m.Dir, name), []byte(format(m.From, msg, now)), 0o600); err != nil {
+		return fmt.Errorf("could not save message: %w", err)
+	}
+	return nil
+}
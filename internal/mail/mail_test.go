@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var message = Message{
+	To:      "walt@example.com",
+	Subject: "Verify your email",
+	Body:    "Open this link:\nhttp://localhost:8080/api/users/verify?token=abc",
+}
+
+func TestWriterMailer(t *testing.T) {
+	var out strings.Builder
+	mailer := NewWriterMailer(&out, "chirpy@example.com")
+	if err := mailer.Send(context.Background(), message); err != nil {
+		t.Fatalf("could not send: %s", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: walt@example.com\r\n",
+		"Subject: Verify your email\r\n",
+		"\r\n\r\nOpen this link:\r\nhttp://localhost:8080/api/users/verify?token=abc",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := New("file", "chirpy@example.com", dir)
+	if err != nil {
+		t.Fatalf("could not create mailer: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), message); err != nil {
+			t.Fatalf("could not send: %s", err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("got files %v, %v, want 2", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("could not read message: %s", err)
+	}
+	if !strings.Contains(string(data), "To: walt@example.com\r\n") {
+		t.Errorf("saved message %q has no recipient", data)
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	var out strings.Builder
+	mailer := NewWriterMailer(&out, "chirpy@example.com")
+	var tests = []struct {
+		name string
+		msg  Message
+	}{
+		{"recipient", Message{To: "walt@example.com\r\nBcc: jesse@example.com", Subject: "hi"}},
+		{"subject", Message{To: "walt@example.com", Subject: "hi\nBcc: jesse@example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := mailer.Send(context.Background(), test.msg); err == nil {
+				t.Errorf("message with a line break in a header was sent")
+			}
+		})
+	}
+	if out.Len() != 0 {
+		t.Errorf("rejected messages were written: %q", out.String())
+	}
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name string
+		kind string
+		dir  string
+		want bool
+	}{
+		{"default", "", "", true},
+		{"stdout", "stdout", "", true},
+		{"file without directory", "file", "", false},
+		{"unknown", "smtp", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.kind, "chirpy@example.com", test.dir)
+			if (err == nil) != test.want {
+				t.Errorf("New(%q) error = %v", test.kind, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const Replacement = "****"
+
+// Filter replaces banned words in chirp bodies. The word list is read from an
+// optional file plus an optional inline list and can be reloaded at any time.
+type Filter struct {
+	path   string
+	inline []string
+
+	mu      sync.RWMutex
+	pattern *regexp.Regexp
+}
+
+func NewFilter(path string, inline []string) (*Filter, error) {
+	f := &Filter{path: path, inline: inline}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ParseWords splits a comma separated list such as the PROFANITY_WORDS
+// environment variable.
+func ParseWords(list string) []string {
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// LoadWords reads one word per line, skipping blank lines and # comments.
+func LoadWords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open word list: %w", err)
+	}
+	defer file.Close()
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read word list: %w", err)
+	}
+	return words, nil
+}
+
+// Reload rebuilds the filter from its word sources. The previous list stays
+// in use if the file cannot be read.
+func (f *Filter) Reload() error {
+	words := append([]string{}, f.inline...)
+	if f.path != "" {
+		fileWords, err := LoadWords(f.path)
+		if err != nil {
+			return err
+		}
+		words = append(words, fileWords...)
+	}
+	pattern := compile(words)
+	f.mu.Lock()
+	f.pattern = pattern
+	f.mu.Unlock()
+	return nil
+}
+
+// Clean replaces every banned word in body, ignoring case and matching whole
+// words only. It reports whether anything was replaced.
+//
+// Word boundaries are found here rather than with \b, which only knows ASCII:
+// a match has to start where a word starts, and the pattern itself requires
+// it to end where a word ends.
+func (f *Filter) Clean(body string) (string, bool) {
+	f.mu.RLock()
+	pattern := f.pattern
+	f.mu.RUnlock()
+	if pattern == nil {
+		return body, false
+	}
+	var cleaned strings.Builder
+	changed := false
+	inWord := false
+	for i := 0; i < len(body); {
+		if !inWord {
+			if match := pattern.FindStringSubmatchIndex(body[i:]); match != nil {
+				cleaned.WriteString(Replacement)
+				i += match[3]
+				changed = true
+				inWord = true
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(body[i:])
+		cleaned.WriteString(body[i : i+size])
+		inWord = isWordRune(r)
+		i += size
+	}
+	if !changed {
+		return body, false
+	}
+	return cleaned.String(), true
+}
+
+// isWordRune reports whether r can be part of a word. Combining marks count,
+// so a letter written with a separate accent is not split from its word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r)
+}
+
+func compile(words []string) *regexp.Regexp {
+	if len(words) == 0 {
+		return nil
+	}
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(strings.ToLower(word)))
+	}
+	// try longer words first so a phrase wins over a word it contains
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	// the match is the first group; the rest only checks the word ends there
+	return regexp.MustCompile(`(?i)^(` + strings.Join(quoted, "|") + `)(?:$|[^\p{L}\p{M}\p{N}_])`)
+}
@@ -0,0 +1,81 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	var tests = []struct {
+		name    string
+		words   []string
+		body    string
+		want    string
+		changed bool
+	}{
+		{"clean body", []string{"kerfuffle"}, "I had something interesting for breakfast", "I had something interesting for breakfast", false},
+		{"banned word", []string{"kerfuffle"}, "What a kerfuffle this is", "What a **** this is", true},
+		{"case insensitive", []string{"kerfuffle"}, "What a KerFuffle this is", "What a **** this is", true},
+		{"whole words only", []string{"kerfuffle"}, "What a kerfuffles this is", "What a kerfuffles this is", false},
+		{"punctuation", []string{"sharbert"}, "Sharbert! is next", "****! is next", true},
+		{"several words", []string{"kerfuffle", "fornax"}, "fornax and kerfuffle", "**** and ****", true},
+		{"no words", nil, "What a kerfuffle this is", "What a kerfuffle this is", false},
+		{"repeated word", []string{"kerfuffle"}, "kerfuffle kerfuffle", "**** ****", true},
+		{"cyrillic word", []string{"дурак"}, "ты дурак!", "ты ****!", true},
+		{"cyrillic case insensitive", []string{"дурак"}, "ТЫ ДУРАК", "ТЫ ****", true},
+		{"cyrillic whole words only", []string{"дурак"}, "дураки", "дураки", false},
+		{"accented letter ends word", []string{"caf"}, "un café", "un café", false},
+		{"accented letter starts word", []string{"fe"}, "café", "café", false},
+		{"combining accent", []string{"cafe"}, "cafe\u0301 au lait", "cafe\u0301 au lait", false},
+		{"accented banned word", []string{"café"}, "Café au lait", "**** au lait", true},
+		{"word inside a rejected phrase", []string{"foo bar", "bar"}, "xfoo bar", "xfoo ****", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewFilter("", test.words)
+			if err != nil {
+				t.Fatalf("could not create filter: %s", err)
+			}
+			got, changed := filter.Clean(test.body)
+			if got != test.want {
+				t.Errorf("Clean(%q) = %q, want %q", test.body, got, test.want)
+			}
+			if changed != test.changed {
+				t.Errorf("Clean(%q) changed = %v, want %v", test.body, changed, test.changed)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# banned words\nkerfuffle\n"), 0o600); err != nil {
+		t.Fatalf("could not write word list: %s", err)
+	}
+	filter, err := NewFilter(path, []string{"fornax"})
+	if err != nil {
+		t.Fatalf("could not create filter: %s", err)
+	}
+	if got, _ := filter.Clean("kerfuffle sharbert fornax"); got != "**** sharbert ****" {
+		t.Errorf("got %q before reload", got)
+	}
+	if err := os.WriteFile(path, []byte("sharbert\n"), 0o600); err != nil {
+		t.Fatalf("could not write word list: %s", err)
+	}
+	if err := filter.Reload(); err != nil {
+		t.Fatalf("could not reload: %s", err)
+	}
+	if got, _ := filter.Clean("kerfuffle sharbert fornax"); got != "kerfuffle **** ****" {
+		t.Errorf("got %q after reload", got)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("could not remove word list: %s", err)
+	}
+	if err := filter.Reload(); err == nil {
+		t.Errorf("expected reload of missing file to fail")
+	}
+	if got, _ := filter.Clean("kerfuffle sharbert fornax"); got != "kerfuffle **** ****" {
+		t.Errorf("failed reload changed the word list: %q", got)
+	}
+}
@@ -0,0 +1,284 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID provider. It hands out one code per
+// authorization request and checks the PKCE verifier when it is redeemed.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	// claims lets a test change the ID token before it is signed
+	claims func(jwt.MapClaims)
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+type authRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	m := &mockProvider{t: t, key: key, kid: "key-1", codes: map[string]authRequest{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks{Keys: []jwk{{
+			Kty: "RSA",
+			Kid: m.kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "chirpy" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		m.mu.Lock()
+		request, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+		if !ok || codeChallenge(r.FormValue("code_verifier")) != request.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken(request.nonce),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) idToken(nonce string) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "user-123",
+		"aud":            "chirpy",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "walt@example.com",
+		"email_verified": true,
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("could not sign id token: %s", err)
+	}
+	return signed
+}
+
+// authorize plays the user's browser: it follows the auth URL and returns
+// the code the provider would redirect back with.
+func (m *mockProvider) authorize(authURL string) string {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatalf("could not parse auth url: %s", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "chirpy" {
+		m.t.Fatalf("unexpected auth url %s", authURL)
+	}
+	code := RandomString()
+	m.mu.Lock()
+	m.codes[code] = authRequest{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       m.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/oidc/mock/callback",
+	})
+}
+
+func TestLogin(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+	state, nonce, verifier := RandomString(), RandomString(), RandomString()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("could not make auth url: %s", err)
+	}
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") || !strings.Contains(authURL, "state="+state) {
+		t.Errorf("unexpected auth url %s", authURL)
+	}
+	token, err := p.Exchange(ctx, m.authorize(authURL), verifier, nonce)
+	if err != nil {
+		t.Fatalf("could not exchange code: %s", err)
+	}
+	if token.Subject != "user-123" || token.Email != "walt@example.com" || !token.EmailVerified {
+		t.Errorf("unexpected claims %+v", token)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	var tests = []struct {
+		name     string
+		claims   func(jwt.MapClaims)
+		verifier string
+		nonce    string
+	}{
+		{name: "wrong code verifier", verifier: "wrong"},
+		{name: "wrong nonce", nonce: "wrong"},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "other authorized party", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{"chirpy", "someone-else"}
+			c["azp"] = "someone-else"
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = test.claims
+			p := m.provider()
+			ctx := context.Background()
+			nonce, verifier := RandomString(), RandomString()
+			authURL, err := p.AuthCodeURL(ctx, RandomString(), nonce, verifier)
+			if err != nil {
+				t.Fatalf("could not make auth url: %s", err)
+			}
+			code := m.authorize(authURL)
+			if test.verifier != "" {
+				verifier = test.verifier
+			}
+			if test.nonce != "" {
+				nonce = test.nonce
+			}
+			if _, err := p.Exchange(ctx, code, verifier, nonce); err == nil {
+				t.Errorf("exchange succeeded")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForeignKey(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": m.server.URL, "sub": "user-123", "aud": "chirpy", "nonce": "n",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = m.kid
+	signed, _ := token.SignedString(other)
+	if _, err := p.Verify(context.Background(), signed, "n"); err == nil {
+		t.Errorf("token signed with a foreign key verified")
+	}
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, token.Claims)
+	signed, _ = hs.SignedString([]byte("chirpy"))
+	if _, err := p.Verify(context.Background(), signed, "n"); err == nil {
+		t.Errorf("HS256 token verified")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+	if _, err := p.Verify(ctx, m.idToken("n"), "n"); err != nil {
+		t.Fatalf("could not verify: %s", err)
+	}
+	m.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	m.kid = "key-2"
+	// keys were fetched moments ago, so the new kid is not looked up yet
+	if _, err := p.Verify(ctx, m.idToken("n"), "n"); err == nil {
+		t.Fatalf("verified with a key that was not fetched")
+	}
+	p.keys.fetched = time.Now().Add(-minRefresh)
+	if _, err := p.Verify(ctx, m.idToken("n"), "n"); err != nil {
+		t.Errorf("could not verify after rotation: %s", err)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider(Config{Issuer: m.server.URL + "/", ClientID: "chirpy"})
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Errorf("provider with a different issuer accepted")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := codeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("codeChallenge = %s", got)
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var tests = []struct {
+		name  string
+		key   jwk
+		valid bool
+	}{
+		{"ec", jwk{Kty: "EC", Crv: "P-256",
+			X: base64.RawURLEncoding.EncodeToString(ec.X.Bytes()),
+			Y: base64.RawURLEncoding.EncodeToString(ec.Y.Bytes())}, true},
+		{"ec off curve", jwk{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}, false},
+		{"ed25519", jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(make([]byte, 32))}, true},
+		{"short ed25519", jwk{Kty: "OKP", Crv: "Ed25519", X: "AQ"}, false},
+		{"rsa without modulus", jwk{Kty: "RSA", E: "AQAB"}, false},
+		{"symmetric", jwk{Kty: "oct"}, false},
+	}
+	for _, test := range tests {
+		if _, err := test.key.publicKey(); (err == nil) != test.valid {
+			t.Errorf("%s: error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often idle buckets are dropped.
+const pruneInterval = time.Minute
+
+// Limit is a token bucket: a client may make Burst requests at once, and
+// regains Rate requests per second up to Burst again.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// window is how long an empty bucket takes to fill up.
+func (l Limit) window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// Limiter keeps a token bucket for every key it has seen recently. It is safe
+// for concurrent use.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Result describes a bucket after a request was counted against it.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a refused request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Allow takes a token from the bucket for key, creating a full bucket the
+// first time key is seen. A key keeps its tokens when its limit changes,
+// capped at the new burst.
+func (l *Limiter) Allow(key string, limit Limit) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+		l.lastPrune = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+	result := Result{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return result
+}
+
+// prune drops buckets that have refilled completely, since a new bucket for
+// their key would be the same.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.limit.window() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// SetHeaders describes the result in the RateLimit-Policy and RateLimit
+// headers of the IETF rate limit headers draft, plus Retry-After when the
+// request was refused. policy names the budget the request counted against.
+func (r Result) SetHeaders(h http.Header, policy string) {
+	h.Set("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", policy, r.Limit.Burst, ceilSeconds(r.Limit.window())))
+	h.Set("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, r.Remaining, ceilSeconds(r.Reset)))
+	if !r.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(r.RetryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
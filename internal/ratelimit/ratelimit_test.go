@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	l := New()
+	l.now = c.Now
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 3}
+	var tests = []struct {
+		name      string
+		advance   time.Duration
+		allowed   bool
+		remaining int
+	}{
+		{"first request", 0, true, 2},
+		{"second request", 0, true, 1},
+		{"third request", 0, true, 0},
+		{"burst used up", 0, false, 0},
+		{"half a token later", 500 * time.Millisecond, false, 0},
+		{"one token later", 500 * time.Millisecond, true, 0},
+		{"long idle refills to burst only", time.Hour, true, 2},
+	}
+	l, c := newTestLimiter()
+	for _, test := range tests {
+		c.now = c.now.Add(test.advance)
+		result := l.Allow("user", limit)
+		if result.Allowed != test.allowed || result.Remaining != test.remaining {
+			t.Errorf("%s: allowed %v remaining %d, want allowed %v remaining %d",
+				test.name, result.Allowed, result.Remaining, test.allowed, test.remaining)
+		}
+	}
+}
+
+func TestAllowRetryAfter(t *testing.T) {
+	l, _ := newTestLimiter()
+	limit := Limit{Rate: 0.5, Burst: 1}
+	l.Allow("user", limit)
+	result := l.Allow("user", limit)
+	if result.Allowed {
+		t.Fatalf("request allowed after the burst was used")
+	}
+	if result.RetryAfter != 2*time.Second {
+		t.Errorf("RetryAfter = %s, want 2s", result.RetryAfter)
+	}
+	if result.Reset != 2*time.Second {
+		t.Errorf("Reset = %s, want 2s", result.Reset)
+	}
+}
+
+func TestAllowSeparateKeys(t *testing.T) {
+	l, _ := newTestLimiter()
+	limit := Limit{Rate: 1, Burst: 1}
+	if !l.Allow("read:alice", limit).Allowed || !l.Allow("write:alice", limit).Allowed || !l.Allow("read:bob", limit).Allowed {
+		t.Errorf("first request for a new key refused")
+	}
+	if l.Allow("read:alice", limit).Allowed {
+		t.Errorf("second request for the same key allowed")
+	}
+}
+
+func TestAllowLimitChange(t *testing.T) {
+	l, _ := newTestLimiter()
+	l.Allow("user", Limit{Rate: 1, Burst: 2})
+	// upgrading keeps the tokens left, it does not hand out a new burst
+	if result := l.Allow("user", Limit{Rate: 2, Burst: 10}); result.Remaining != 0 {
+		t.Errorf("remaining after upgrade = %d, want 0", result.Remaining)
+	}
+	// downgrading caps the tokens at the new burst
+	l.Allow("other", Limit{Rate: 1, Burst: 10})
+	if result := l.Allow("other", Limit{Rate: 1, Burst: 2}); result.Remaining != 1 {
+		t.Errorf("remaining after downgrade = %d, want 1", result.Remaining)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, c := newTestLimiter()
+	l.Allow("idle", Limit{Rate: 1, Burst: 5})
+	l.Allow("slow", Limit{Rate: 0.01, Burst: 5})
+	c.now = c.now.Add(2 * pruneInterval)
+	l.Allow("new", Limit{Rate: 1, Burst: 5})
+	if _, ok := l.buckets["idle"]; ok {
+		t.Errorf("refilled bucket was not pruned")
+	}
+	if _, ok := l.buckets["slow"]; !ok {
+		t.Errorf("bucket that is still refilling was pruned")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	var tests = []struct {
+		name   string
+		result Result
+		policy string
+		limit  string
+		retry  string
+	}{
+		{
+			name:   "allowed",
+			result: Result{Allowed: true, Limit: Limit{Rate: 1, Burst: 60}, Remaining: 59, Reset: 1500 * time.Millisecond},
+			policy: `"read";q=60;w=60`,
+			limit:  `"read";r=59;t=2`,
+		},
+		{
+			name:   "refused",
+			result: Result{Limit: Limit{Rate: 1, Burst: 60}, Reset: time.Minute, RetryAfter: 200 * time.Millisecond},
+			policy: `"read";q=60;w=60`,
+			limit:  `"read";r=0;t=60`,
+			retry:  "1",
+		},
+	}
+	for _, test := range tests {
+		h := http.Header{}
+		test.result.SetHeaders(h, "read")
+		if got := h.Get("RateLimit-Policy"); got != test.policy {
+			t.Errorf("%s: RateLimit-Policy = %s, want %s", test.name, got, test.policy)
+		}
+		if got := h.Get("RateLimit"); got != test.limit {
+			t.Errorf("%s: RateLimit = %s, want %s", test.name, got, test.limit)
+		}
+		if got := h.Get("Retry-After"); got != test.retry {
+			t.Errorf("%s: Retry-After = %q, want %q", test.name, got, test.retry)
+		}
+	}
+}
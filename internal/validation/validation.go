@@ -0,0 +1,74 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxChirpLength is the longest chirp allowed, counted in user-perceived
+// characters (grapheme clusters) rather than bytes or runes.
+const MaxChirpLength = 140
+
+var (
+	ErrInvalidUTF8      = errors.New("is not valid UTF-8")
+	ErrControlCharacter = errors.New("contains control characters")
+	ErrTooLong          = errors.New("is too long")
+	ErrInvalidEmail     = errors.New("is not a valid email address")
+)
+
+// maxEmailLength is the longest address SMTP can deliver to (RFC 5321).
+const maxEmailLength = 254
+
+// ChirpBody validates a chirp body and returns it in Unicode normalization
+// form C, so that visually identical text is stored and measured the same way.
+func ChirpBody(body string) (string, error) {
+	normalized, err := Text(body, MaxChirpLength)
+	if err != nil {
+		return "", fmt.Errorf("Chirp %w", err)
+	}
+	return normalized, nil
+}
+
+// Text applies the chirp rules to any user supplied text: it must be valid
+// UTF-8, contain no control characters other than line breaks, and be at most
+// maxLength grapheme clusters long once normalized to NFC.
+func Text(s string, maxLength int) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", ErrInvalidUTF8
+	}
+	normalized := norm.NFC.String(s)
+	for _, r := range normalized {
+		if unicode.IsControl(r) && r != '\n' {
+			return "", fmt.Errorf("%w: %U", ErrControlCharacter, r)
+		}
+	}
+	if uniseg.GraphemeClusterCount(normalized) > maxLength {
+		return "", ErrTooLong
+	}
+	return normalized, nil
+}
+
+// Email checks that s is a bare email address, such as "walt@example.com",
+// with no display name, angle brackets or surrounding space, and a domain
+// that has at least one dot.
+func Email(s string) error {
+	if len(s) > maxEmailLength {
+		return fmt.Errorf("Email %w", ErrInvalidEmail)
+	}
+	address, err := mail.ParseAddress(s)
+	if err != nil || address.Name != "" || address.Address != s {
+		return fmt.Errorf("Email %w", ErrInvalidEmail)
+	}
+	_, domain, _ := strings.Cut(address.Address, "@")
+	if !strings.Contains(strings.Trim(domain, "."), ".") {
+		return fmt.Errorf("Email %w", ErrInvalidEmail)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChirpBody(t *testing.T) {
+	var tests = []struct {
+		name string
+		body string
+		want string
+		err  error
+	}{
+		{"plain text", "I had something interesting for breakfast", "I had something interesting for breakfast", nil},
+		{"line break", "first line\nsecond line", "first line\nsecond line", nil},
+		{"140 letters", strings.Repeat("a", 140), strings.Repeat("a", 140), nil},
+		{"141 letters", strings.Repeat("a", 141), "", ErrTooLong},
+		{"140 multibyte characters", strings.Repeat("é", 140), strings.Repeat("é", 140), nil},
+		{"140 emoji", strings.Repeat("🐦", 140), strings.Repeat("🐦", 140), nil},
+		{"140 family emoji", strings.Repeat("👨‍👩‍👧", 140), strings.Repeat("👨‍👩‍👧", 140), nil},
+		{"141 emoji", strings.Repeat("🐦", 141), "", ErrTooLong},
+		{"140 decomposed characters", strings.Repeat("e\u0301", 140), strings.Repeat("\u00e9", 140), nil},
+		{"normalizes to NFC", "cafe\u0301", "caf\u00e9", nil},
+		{"null byte", "chirp\x00", "", ErrControlCharacter},
+		{"escape", "\x1b[31mred", "", ErrControlCharacter},
+		{"tab", "a\tb", "", ErrControlCharacter},
+		{"invalid utf-8", "chirp\xff", "", ErrInvalidUTF8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ChirpBody(test.body)
+			if !errors.Is(err, test.err) {
+				t.Errorf("ChirpBody(%q) error = %v, want %v", test.body, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("ChirpBody(%q) = %q, want %q", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	var tests = []struct {
+		name      string
+		text      string
+		maxLength int
+		want      string
+		err       error
+	}{
+		{"under limit", "Chirpy fan", 50, "Chirpy fan", nil},
+		{"at limit", strings.Repeat("🐦", 5), 5, strings.Repeat("🐦", 5), nil},
+		{"over limit", strings.Repeat("🐦", 6), 5, "", ErrTooLong},
+		{"empty", "", 5, "", nil},
+		{"control character", "bell\a", 50, "", ErrControlCharacter},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Text(test.text, test.maxLength)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Text(%q) error = %v, want %v", test.text, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("Text(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestChirpBodyErrorMessage(t *testing.T) {
+	_, err := ChirpBody(strings.Repeat("a", 141))
+	if err == nil || err.Error() != "Chirp is too long" {
+		t.Errorf("got error %v, want %q", err, "Chirp is too long")
+	}
+}
+
+func TestEmail(t *testing.T) {
+	var tests = []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{"plain address", "walt@example.com", true},
+		{"subaddress", "walt+chirpy@mail.example.co.uk", true},
+		{"empty", "", false},
+		{"no at sign", "walt.example.com", false},
+		{"no local part", "@example.com", false},
+		{"no domain", "walt@", false},
+		{"domain without dot", "walt@localhost", false},
+		{"display name", "Walt <walt@example.com>", false},
+		{"angle brackets", "<walt@example.com>", false},
+		{"surrounding space", " walt@example.com ", false},
+		{"two at signs", "walt@white@example.com", false},
+		{"too long", strings.Repeat("a", 250) + "@example.com", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Email(test.email)
+			if (err == nil) != test.want {
+				t.Errorf("Email(%q) error = %v, want valid %v", test.email, err, test.want)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidEmail) {
+				t.Errorf("Email(%q) error = %v, want %v", test.email, err, ErrInvalidEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) likeChirp(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	chirp, err := cfg.dB.GetChirpByID(r.Context(), chirpId)
+	if err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+	// liking twice is a no-op, the insert ignores an existing like
+	if err := cfg.dB.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  user_id,
+		ChirpID: chirp.ID,
+	}); err != nil {
+		log.Printf("could not like chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unlikeChirp(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	if err := cfg.dB.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  user_id,
+		ChirpID: chirpId,
+	}); err != nil {
+		log.Printf("could not unlike chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachLikes fills in the like counts of chirps, and whether viewer liked
+// them when the request was made by a signed in user.
+func (cfg *apiConfig) attachLikes(ctx context.Context, viewer uuid.NullUUID, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	counts, err := cfg.dB.GetLikeCounts(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("could not get like counts: %w", err)
+	}
+	countById := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		countById[count.ChirpID] = count.LikeCount
+	}
+	likedById := make(map[uuid.UUID]bool)
+	if viewer.Valid {
+		liked, err := cfg.dB.GetLikedChirps(ctx, database.GetLikedChirpsParams{
+			UserID:   viewer.UUID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return fmt.Errorf("could not get liked chirps: %w", err)
+		}
+		for _, id := range liked {
+			likedById[id] = true
+		}
+	}
+	for _, chirp := range chirps {
+		chirp.LikeCount = countById[chirp.ID]
+		if viewer.Valid {
+			likedByMe := likedById[chirp.ID]
+			chirp.LikedByMe = &likedByMe
+		}
+	}
+	return nil
+}
@@ -1,23 +1,53 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/NHemmerly/http-servers/internal/auth"
 	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/mail"
+	"github.com/NHemmerly/http-servers/internal/moderation"
+	"github.com/NHemmerly/http-servers/internal/ratelimit"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	conn           *sql.DB
 	dB             *database.Queries
 	platform       string
-	secret         string
+	tokens         auth.TokenConfig
+	hasher         auth.PasswordHasher
+	dummyHash      string
 	polka          string
+	profanity      *moderation.Filter
+	trustProxy     bool
+	adminKey       string
+	revocations    *revocationCache
+	limiter        *ratelimit.Limiter
+	oidcProviders  map[string]*identityProvider
+	mailer         mail.Mailer
+	baseURL        string
+	passwordResets chan string
+}
+
+// envOr returns the environment variable key, or fallback when it is unset.
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
 }
 
 func main() {
@@ -29,17 +59,99 @@ func main() {
 		os.Exit(1)
 	}
 	dbQueries := database.New(db)
+	profanity, err := moderation.NewFilter(os.Getenv("PROFANITY_FILE"), moderation.ParseWords(os.Getenv("PROFANITY_WORDS")))
+	if err != nil {
+		log.Printf("could not load profanity word list: %s", err)
+		os.Exit(1)
+	}
+	keys, err := auth.LoadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("SECRET"))
+	if err != nil {
+		log.Printf("could not load jwt signing keys: %s", err)
+		os.Exit(1)
+	}
+	leeway, err := time.ParseDuration(envOr("JWT_LEEWAY", "30s"))
+	if err != nil {
+		log.Printf("could not parse JWT_LEEWAY: %s", err)
+		os.Exit(1)
+	}
+	bcryptCost, err := strconv.Atoi(envOr("BCRYPT_COST", "10"))
+	if err != nil {
+		log.Printf("could not parse BCRYPT_COST: %s", err)
+		os.Exit(1)
+	}
+	hasher, err := auth.NewPasswordHasher(os.Getenv("PASSWORD_HASH"), bcryptCost)
+	if err != nil {
+		log.Printf("could not configure password hashing: %s", err)
+		os.Exit(1)
+	}
+	// compared against when a login names an unknown email, so it takes as
+	// long as a login with a wrong password
+	dummyHash, err := hasher.Hash("chirpy-dummy-password")
+	if err != nil {
+		log.Printf("could not hash dummy password: %s", err)
+		os.Exit(1)
+	}
+	mailer, err := mail.New(os.Getenv("MAILER"), envOr("MAIL_FROM", "Chirpy <noreply@chirpy.local>"), os.Getenv("MAIL_DIR"))
+	if err != nil {
+		log.Printf("could not configure mailer: %s", err)
+		os.Exit(1)
+	}
+	baseURL := strings.TrimSuffix(envOr("BASE_URL", "http://localhost:8080"), "/")
+	oidcProviders, err := loadOIDCProviders(baseURL)
+	if err != nil {
+		log.Printf("could not configure identity providers: %s", err)
+		os.Exit(1)
+	}
+	// reload the word list and signing keys on SIGHUP without restarting the server
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		for range hangup {
+			if err := profanity.Reload(); err != nil {
+				log.Printf("could not reload profanity word list: %s", err)
+			} else {
+				log.Printf("reloaded profanity word list")
+			}
+			if err := keys.Reload(); err != nil {
+				log.Printf("could not reload jwt signing keys: %s", err)
+			} else {
+				log.Printf("reloaded jwt signing keys")
+			}
+		}
+	}()
 	apiCfg := apiConfig{
+		conn:     db,
 		dB:       dbQueries,
 		platform: os.Getenv("PLATFORM"),
-		secret:   os.Getenv("SECRET"),
-		polka:    os.Getenv("POLKA_KEY"),
+		tokens: auth.TokenConfig{
+			Keys:     keys,
+			Issuer:   envOr("JWT_ISSUER", "chirpy"),
+			Audience: os.Getenv("JWT_AUDIENCE"),
+			Leeway:   leeway,
+		},
+		hasher:         hasher,
+		dummyHash:      dummyHash,
+		polka:          os.Getenv("POLKA_KEY"),
+		profanity:      profanity,
+		trustProxy:     os.Getenv("TRUST_PROXY") == "true",
+		adminKey:       os.Getenv("ADMIN_KEY"),
+		revocations:    newRevocationCache(),
+		limiter:        ratelimit.New(),
+		oidcProviders:  oidcProviders,
+		mailer:         mailer,
+		baseURL:        baseURL,
+		passwordResets: make(chan string, passwordResetQueueSize),
+	}
+	go apiCfg.cleanupLoginThrottles(context.Background())
+	go apiCfg.syncRevocations(context.Background())
+	for range passwordResetWorkers {
+		go apiCfg.sendPasswordResets(context.Background())
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 	server := &http.Server{
 		Addr:    "localhost:8080",
-		Handler: mux,
+		Handler: apiCfg.middlewareRateLimit(mux),
 	}
 
 	mux.HandleFunc("GET /api/healthz", func(writer http.ResponseWriter, req *http.Request) {
@@ -48,17 +160,52 @@ func main() {
 		writer.Write([]byte("OK"))
 	})
 
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.getJWKS)
 	mux.HandleFunc("POST /admin/reset", apiCfg.resetMetricsHandler)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.getMetricsHandler)
+	mux.HandleFunc("POST /admin/users/{id}/revoke-tokens", apiCfg.adminRevokeTokens)
+	mux.HandleFunc("GET /admin/lockouts", apiCfg.getLockouts)
+	mux.HandleFunc("GET /admin/chirps/{chirpID}/moderation", apiCfg.getModeratedChirps)
 	mux.HandleFunc("PUT /api/users", apiCfg.updateLogin)
 	mux.HandleFunc("POST /api/users", apiCfg.createUser)
+	mux.HandleFunc("GET /api/users/verify", apiCfg.verifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.resendVerification)
+	mux.HandleFunc("GET /api/users/{id}", apiCfg.getUserProfile)
+	mux.HandleFunc("PATCH /api/users/{id}", apiCfg.updateProfile)
+	mux.HandleFunc("POST /api/users/{id}/follow", apiCfg.followUser)
+	mux.HandleFunc("DELETE /api/users/{id}/follow", apiCfg.unfollowUser)
+	mux.HandleFunc("GET /api/users/{id}/followers", apiCfg.getFollowers)
+	mux.HandleFunc("GET /api/users/{id}/following", apiCfg.getFollowing)
+	mux.HandleFunc("GET /api/timeline", apiCfg.getTimeline)
 	mux.HandleFunc("POST /api/login", apiCfg.loginUser)
+	mux.HandleFunc("POST /api/login/totp", apiCfg.loginTOTP)
+	mux.HandleFunc("GET /api/oidc/{provider}/login", apiCfg.startOIDCLogin)
+	mux.HandleFunc("GET /api/oidc/{provider}/callback", apiCfg.oidcCallback)
+	mux.HandleFunc("POST /api/totp/enroll", apiCfg.enrollTOTP)
+	mux.HandleFunc("POST /api/totp/confirm", apiCfg.confirmTOTP)
+	mux.HandleFunc("DELETE /api/totp", apiCfg.disableTOTP)
+	mux.HandleFunc("POST /api/password-reset/request", apiCfg.requestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.confirmPasswordReset)
 	mux.HandleFunc("POST /api/chirps", apiCfg.postChirps)
 	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.searchChirps)
 	mux.HandleFunc("GET /api/chirps/{id}", apiCfg.getChirpById)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/edits", apiCfg.getChirpEdits)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.getThread)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/likes", apiCfg.likeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", apiCfg.unlikeChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.editChirp)
+	mux.HandleFunc("PATCH /api/chirps/{chirpID}", apiCfg.editChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
 	mux.HandleFunc("POST /api/refresh", apiCfg.postRefreshToken)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revokeRefreshToken)
+	mux.HandleFunc("GET /api/sessions", apiCfg.getSessions)
+	mux.HandleFunc("DELETE /api/sessions/{id}", apiCfg.deleteSession)
+	mux.HandleFunc("POST /api/tokens", apiCfg.createAPIToken)
+	mux.HandleFunc("GET /api/tokens", apiCfg.getAPITokens)
+	mux.HandleFunc("DELETE /api/tokens/{id}", apiCfg.deleteAPIToken)
+	mux.HandleFunc("POST /api/logout", apiCfg.logout)
+	mux.HandleFunc("POST /api/logout-all", apiCfg.logoutAll)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgradeChirpyRed)
 
 	server.ListenAndServe()
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/oidc"
+)
+
+const (
+	oidcLoginLifetime = 10 * time.Minute
+	oidcStateCookie   = "chirpy_oidc_state"
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+var (
+	errNoVerifiedEmail = errors.New("identity provider did not share a verified email address")
+	errEmailTaken      = errors.New("an account with this email address already exists; log in with its password and verify the address first")
+	errAccountExists   = errors.New("an account with this email address already exists; log in with its password")
+)
+
+// identityProvider is a configured OpenID Connect provider.
+type identityProvider struct {
+	*oidc.Provider
+	// linkByEmail lets a first login link to an existing account with the
+	// same verified email address. Only providers that never let users claim
+	// an address they do not control can be trusted with that.
+	linkByEmail bool
+}
+
+// loadOIDCProviders reads the identity providers named in the comma separated
+// OIDC_PROVIDERS list. A provider called github is configured by
+// OIDC_GITHUB_ISSUER, OIDC_GITHUB_CLIENT_ID, OIDC_GITHUB_CLIENT_SECRET and the
+// optional OIDC_GITHUB_SCOPES and OIDC_GITHUB_LINK_BY_EMAIL.
+func loadOIDCProviders(baseURL string) (map[string]*identityProvider, error) {
+	providers := map[string]*identityProvider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerName.MatchString(name) {
+			return nil, fmt.Errorf("invalid provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s/api/oidc/%s/callback", baseURL, name),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = &identityProvider{
+			Provider:    oidc.NewProvider(config),
+			linkByEmail: os.Getenv(prefix+"LINK_BY_EMAIL") == "true",
+		}
+	}
+	return providers, nil
+}
+
+// startOIDCLogin sends the user to the identity provider. The state, nonce
+// and PKCE verifier are kept server side for the callback, and the state is
+// also set in a cookie so the callback only works in the browser that
+// started the login.
+func (cfg *apiConfig) startOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("could not start %s login: %s", name, err)
+		respondWithError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+	if err := cfg.dB.DeleteExpiredOIDCLogins(r.Context()); err != nil {
+		log.Printf("could not delete expired oidc logins: %s", err)
+	}
+	if err := cfg.dB.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginLifetime),
+	}); err != nil {
+		log.Printf("could not save oidc login: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	http.SetCookie(w, cfg.oidcStateCookie(state, int(oidcLoginLifetime.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (cfg *apiConfig) oidcStateCookie(state string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oidcCallback finishes a login at the identity provider and logs the user
+// in exactly like a password login, including the TOTP challenge.
+func (cfg *apiConfig) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("%s login failed: %s %s", name, providerError, query.Get("error_description"))
+		respondWithError(w, http.StatusBadRequest, "identity provider refused the login")
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired login state")
+		return
+	}
+	http.SetCookie(w, cfg.oidcStateCookie("", -1))
+	login, err := cfg.dB.UseOIDCLogin(r.Context(), auth.HashToken(state))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && login.Provider != name) {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired login state")
+		return
+	}
+	if err != nil {
+		log.Printf("could not use oidc login: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	idToken, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("could not finish %s login: %s", name, err)
+		respondWithError(w, http.StatusUnauthorized, "could not verify identity")
+		return
+	}
+	user, err := cfg.userForIdentity(r.Context(), name, provider.linkByEmail, idToken)
+	if errors.Is(err, errNoVerifiedEmail) {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, errEmailTaken) || errors.Is(err, errAccountExists) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("could not get user for identity: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	enabled, err := cfg.totpEnabled(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("could not check totp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if enabled {
+		cfg.startLoginChallenge(w, r, user.ID)
+		return
+	}
+	cfg.completeLogin(w, r, &user)
+}
+
+// userForIdentity returns the user linked to an external identity. The first
+// login creates an account for the identity. An existing account with the
+// same email address is only linked when linkByEmail marks the provider as
+// trusted and both the provider and Chirpy have verified the address, so
+// nobody can take over an account by claiming its email at a provider or by
+// signing up with someone else's email first.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, provider string, linkByEmail bool, idToken *oidc.IDToken) (database.User, error) {
+	identity, err := cfg.dB.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  idToken.Subject,
+	})
+	if err == nil {
+		return cfg.dB.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("could not get identity: %w", err)
+	}
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return database.User{}, errNoVerifiedEmail
+	}
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	user, err := qtx.GetUserByEmail(ctx, idToken.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// the account has no usable password until the user resets it
+		hash, err := cfg.hasher.Hash(auth.MakeRefreshToken())
+		if err != nil {
+			return database.User{}, fmt.Errorf("could not hash password: %w", err)
+		}
+		created, err := qtx.CreateUser(ctx, database.CreateUserParams{
+			Email:          idToken.Email,
+			HashedPassword: hash,
+		})
+		if err != nil {
+			return database.User{}, fmt.Errorf("could not create user: %w", err)
+		}
+		if user, err = qtx.VerifyEmail(ctx, database.VerifyEmailParams{
+			ID:    created.ID,
+			Email: created.Email,
+		}); err != nil {
+			return database.User{}, fmt.Errorf("could not verify email: %w", err)
+		}
+	case err != nil:
+		return database.User{}, fmt.Errorf("could not get user by email: %w", err)
+	case !linkByEmail:
+		return database.User{}, errAccountExists
+	case !user.EmailVerifiedAt.Valid:
+		return database.User{}, errEmailTaken
+	}
+	if err := qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  idToken.Subject,
+		UserID:   user.ID,
+		Email:    idToken.Email,
+	}); err != nil {
+		return database.User{}, fmt.Errorf("could not link identity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return database.User{}, fmt.Errorf("could not commit identity: %w", err)
+	}
+	return user, nil
+}
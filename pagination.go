@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+	// maxPageOffset bounds how deep offset cursors can page, which keeps
+	// offset arithmetic far from overflowing and OFFSET scans cheap.
+	maxPageOffset = 10000
+)
+
+// cursor marks the last row of a page. It is handed to clients as an opaque
+// string and decoded back into the (created_at, id) key on the next request.
+type cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := fmt.Sprintf("%s|%s", createdAt.UTC().Format(time.RFC3339Nano), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode cursor: %w", err)
+	}
+	createdAtString, idString, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtString)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse cursor time: %w", err)
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse cursor id: %w", err)
+	}
+	return &cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// params converts the cursor into the nullable arguments used by the keyset
+// queries. A nil cursor starts from the first page.
+func (c *cursor) params() (sql.NullTime, uuid.NullUUID) {
+	if c == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: c.CreatedAt, Valid: true}, uuid.NullUUID{UUID: c.ID, Valid: true}
+}
+
+// Ranked results have no stable key to resume from, so their cursor is an
+// encoded row offset instead.
+func encodeOffsetCursor(offset int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("offset|%d", offset)))
+}
+
+func decodeOffsetCursor(s string) (int32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, fmt.Errorf("could not decode cursor: %w", err)
+	}
+	offsetString, found := strings.CutPrefix(string(raw), "offset|")
+	if !found {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	offset, err := strconv.ParseInt(offsetString, 10, 32)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	if offset > maxPageOffset {
+		return 0, fmt.Errorf("cursor is past the last page")
+	}
+	return int32(offset), nil
+}
+
+func parseLimit(s string) (int32, error) {
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse limit: %w", err)
+	}
+	if limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return int32(limit), nil
+}
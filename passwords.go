@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/mail"
+	"github.com/NHemmerly/http-servers/internal/ratelimit"
+)
+
+const (
+	passwordResetLifetime = time.Hour
+	// passwordResetCooldown is how long after one reset email another one
+	// is not sent, so the endpoint cannot be used to flood an inbox.
+	passwordResetCooldown = 5 * time.Minute
+	// passwordResetWorkers send the queued reset emails, and at most
+	// passwordResetQueueSize requests wait for them.
+	passwordResetWorkers   = 4
+	passwordResetQueueSize = 1000
+)
+
+// Budgets for reset requests, checked before a request is queued. One
+// address cannot fill the queue, and one email is queued at most once per
+// cooldown however many addresses ask for it.
+var (
+	passwordResetAddressLimit = ratelimit.Limit{Rate: 1.0 / 60, Burst: 5}
+	passwordResetEmailLimit   = ratelimit.Limit{Rate: 1 / passwordResetCooldown.Seconds(), Burst: 1}
+)
+
+// requestPasswordReset always responds 202, whether or not the email belongs
+// to an account. The lookup and the email happen after the response is
+// sent, so its timing does not give the answer away either. A client address
+// that asks too often gets a 429 response.
+func (cfg *apiConfig) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	result := cfg.limiter.Allow("password-reset:ip:"+cfg.clientIP(r), passwordResetAddressLimit)
+	if !result.Allowed {
+		result.SetHeaders(w.Header(), "password-reset")
+		respondWithError(w, http.StatusTooManyRequests, "too many password reset requests")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !cfg.limiter.Allow("password-reset:email:"+email, passwordResetEmailLimit).Allowed {
+		log.Printf("password reset requested again within the cooldown, not sending")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	select {
+	case cfg.passwordResets <- req.Email:
+	default:
+		log.Printf("password reset queue is full, dropping request")
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResets sends the queued password reset emails one at a time.
+// main starts passwordResetWorkers of them.
+func (cfg *apiConfig) sendPasswordResets(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case email := <-cfg.passwordResets:
+			if err := cfg.sendPasswordReset(ctx, email); err != nil {
+				log.Printf("could not send password reset: %s", err)
+			}
+		}
+	}
+}
+
+// sendPasswordReset mails a one-time reset token to the account with email,
+// if there is one and it was not sent one within passwordResetCooldown. Only
+// a digest of the token is stored.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := cfg.dB.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get user by email: %w", err)
+	}
+	token := auth.MakeRefreshToken()
+	now := time.Now().UTC()
+	rows, err := cfg.dB.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetLifetime),
+		SentAfter: now.Add(-passwordResetCooldown),
+	})
+	if err != nil {
+		return fmt.Errorf("could not save password reset: %w", err)
+	}
+	if rows == 0 {
+		return nil
+	}
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account. "+
+			"To choose a new password, send this token to POST %s/api/password-reset/confirm:\n\n%s\n\n"+
+			"It works once and expires in 1 hour. If you did not ask for a reset, ignore this email; "+
+			"your password has not changed.\n", cfg.baseURL, token),
+	})
+}
+
+// confirmPasswordReset sets a new password for the holder of a reset token.
+// Every outstanding reset token, refresh token, access token and personal
+// access token of the user stops working, so anyone who had the old password
+// is signed out.
+func (cfg *apiConfig) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirm
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	userId, err := qtx.UsePasswordReset(r.Context(), auth.HashToken(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		log.Printf("could not use password reset: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	user, err := qtx.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	// a rejected password rolls back, so the token can be used for another try
+	if !checkPassword(w, req.Password, user.Email) {
+		return
+	}
+	hashed, err := cfg.hasher.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not hash password")
+		return
+	}
+	if err := qtx.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		HashedPassword: hashed,
+		ID:             user.ID,
+	}); err != nil {
+		log.Printf("could not update password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := qtx.DeletePasswordResets(r.Context(), user.ID); err != nil {
+		log.Printf("could not delete password resets: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	notBefore, err := cfg.revokeUserTokens(r.Context(), qtx, user.ID)
+	if err != nil {
+		log.Printf("could not revoke tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit password reset: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	cfg.revocations.setCutoff(user.ID, notBefore)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/ratelimit"
+)
+
+// Request budgets per client. Writes such as posting a chirp are limited more
+// tightly than reads, and Chirpy Red members get more of both.
+var (
+	readLimit     = ratelimit.Limit{Rate: 5, Burst: 100}
+	writeLimit    = ratelimit.Limit{Rate: 0.5, Burst: 30}
+	redReadLimit  = ratelimit.Limit{Rate: 10, Burst: 200}
+	redWriteLimit = ratelimit.Limit{Rate: 2, Burst: 60}
+)
+
+// requestLimit returns the name and size of the budget a request counts
+// against.
+func requestLimit(method string, isChirpyRed bool) (string, ratelimit.Limit) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if isChirpyRed {
+			return "read", redReadLimit
+		}
+		return "read", readLimit
+	}
+	if isChirpyRed {
+		return "write", redWriteLimit
+	}
+	return "write", writeLimit
+}
+
+// rateLimitKey identifies the client a request counts against: the user
+// named by a valid bearer token, the personal access token, or else the
+// client address. It must not touch the database, since it runs before any
+// limit is applied; so a personal access token is keyed by its digest without
+// being looked up, and always gets the standard budget. Neither it nor access
+// token revocation is checked here; the handler still rejects invalid tokens.
+func (cfg *apiConfig) rateLimitKey(r *http.Request) (string, bool) {
+	if access, err := auth.GetBearerToken(r.Header); err == nil {
+		if auth.IsPersonalToken(access) {
+			return "pat:" + auth.HashToken(access)[:16], false
+		}
+		if claims, err := auth.ParseJWT(access, cfg.tokens); err == nil {
+			if userId, err := auth.SubjectID(claims); err == nil {
+				return "user:" + userId.String(), claims.IsChirpyRed
+			}
+		}
+	}
+	return "ip:" + cfg.clientIP(r), false
+}
+
+func (cfg *apiConfig) middlewareRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, isChirpyRed := cfg.rateLimitKey(r)
+		policy, limit := requestLimit(r.Method, isChirpyRed)
+		result := cfg.limiter.Allow(policy+":"+key, limit)
+		result.SetHeaders(w.Header(), policy)
+		if !result.Allowed {
+			respondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
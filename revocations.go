@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenLifetime = time.Hour
+	// revocationSyncInterval bounds how long a revocation made by another
+	// server can go unnoticed by this one.
+	revocationSyncInterval = 30 * time.Second
+	// maxRevocationSyncBackoff is the longest wait between retries while
+	// the database is unavailable.
+	maxRevocationSyncBackoff = 5 * time.Minute
+)
+
+// revocationCache keeps the revoked access tokens and per-user cutoffs in
+// memory so checking a token does not cost a query. The database is the
+// source of truth; syncRevocations reloads the cache from it in the
+// background.
+type revocationCache struct {
+	mu      sync.RWMutex
+	tokens  map[uuid.UUID]time.Time
+	cutoffs map[uuid.UUID]time.Time
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		tokens:  map[uuid.UUID]time.Time{},
+		cutoffs: map[uuid.UUID]time.Time{},
+	}
+}
+
+// load reloads the cache from the database. Revocations and cutoffs that can
+// no longer match a live token are skipped; a token is accepted for leeway
+// past its expiry, so they are kept that much longer. The queries run without
+// the lock held, so requests keep reading the old maps until the new ones are
+// ready.
+func (c *revocationCache) load(ctx context.Context, q *database.Queries, leeway time.Duration) error {
+	expired := time.Now().UTC().Add(-leeway)
+	if err := q.DeleteExpiredAccessTokenRevocations(ctx, expired); err != nil {
+		return fmt.Errorf("could not delete expired revocations: %w", err)
+	}
+	revoked, err := q.ListRevokedAccessTokens(ctx, expired)
+	if err != nil {
+		return fmt.Errorf("could not list revoked access tokens: %w", err)
+	}
+	cutoffs, err := q.ListAccessTokenCutoffs(ctx, expired.Add(-accessTokenLifetime))
+	if err != nil {
+		return fmt.Errorf("could not list access token cutoffs: %w", err)
+	}
+	tokens := make(map[uuid.UUID]time.Time, len(revoked))
+	for _, token := range revoked {
+		tokens[token.Jti] = token.ExpiresAt
+	}
+	notBefore := make(map[uuid.UUID]time.Time, len(cutoffs))
+	for _, cutoff := range cutoffs {
+		notBefore[cutoff.UserID] = cutoff.NotBefore
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = tokens
+	c.cutoffs = notBefore
+	return nil
+}
+
+func (c *revocationCache) addToken(jti uuid.UUID, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[jti] = expiresAt
+}
+
+func (c *revocationCache) setCutoff(userId uuid.UUID, notBefore time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if notBefore.After(c.cutoffs[userId]) {
+		c.cutoffs[userId] = notBefore
+	}
+}
+
+// isRevoked reports whether the token has been revoked by its jti or was
+// issued to userId before their cutoff.
+func (c *revocationCache) isRevoked(claims *auth.Claims, userId uuid.UUID) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if jti, err := uuid.Parse(claims.ID); err == nil {
+		if _, ok := c.tokens[jti]; ok {
+			return true
+		}
+	}
+	cutoff, ok := c.cutoffs[userId]
+	if !ok {
+		return false
+	}
+	return claims.IssuedBefore(cutoff)
+}
+
+// syncRevocations reloads the revocation cache every revocationSyncInterval.
+// While the database is unavailable the cache is left as it is, since a
+// stale cache is better than rejecting every request, and retries back off
+// up to maxRevocationSyncBackoff.
+func (cfg *apiConfig) syncRevocations(ctx context.Context) {
+	wait := time.Duration(0)
+	backoff := revocationSyncInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if err := cfg.revocations.load(ctx, cfg.dB, cfg.tokens.Leeway); err != nil {
+			log.Printf("could not sync revocations: %s", err)
+			wait = backoff
+			backoff = min(2*backoff, maxRevocationSyncBackoff)
+			continue
+		}
+		wait = revocationSyncInterval
+		backoff = revocationSyncInterval
+	}
+}
+
+// checkRevoked returns an error when the access token has been revoked.
+func (cfg *apiConfig) checkRevoked(claims *auth.Claims, userId uuid.UUID) error {
+	if cfg.revocations.isRevoked(claims, userId) {
+		return fmt.Errorf("access token has been revoked")
+	}
+	return nil
+}
+
+// revokeAccessToken revokes a single access token until it expires.
+func (cfg *apiConfig) revokeAccessToken(ctx context.Context, claims *auth.Claims, userId uuid.UUID) error {
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("could not parse jti: %w", err)
+	}
+	expiresAt := time.Now().UTC().Add(accessTokenLifetime)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time.UTC()
+	}
+	if err := cfg.dB.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		Jti:       jti,
+		UserID:    userId,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return fmt.Errorf("could not revoke access token: %w", err)
+	}
+	cfg.revocations.addToken(jti, expiresAt)
+	return nil
+}
+
+// revokeUserTokens signs userId out everywhere: every refresh token is
+// revoked, every access token issued so far stops being accepted and every
+// personal access token is deleted. It
+// returns the new cutoff, which the caller passes to
+// cfg.revocations.setCutoff once q's transaction has committed.
+func (cfg *apiConfig) revokeUserTokens(ctx context.Context, q *database.Queries, userId uuid.UUID) (time.Time, error) {
+	if err := q.RevokeAllUserTokens(ctx, userId); err != nil {
+		return time.Time{}, fmt.Errorf("could not revoke refresh tokens: %w", err)
+	}
+	notBefore, err := q.SetAccessTokenCutoff(ctx, database.SetAccessTokenCutoffParams{
+		UserID:    userId,
+		NotBefore: auth.RevocationCutoff(time.Now().UTC()),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not set access token cutoff: %w", err)
+	}
+	if err := q.DeleteAPITokens(ctx, userId); err != nil {
+		return time.Time{}, fmt.Errorf("could not delete api tokens: %w", err)
+	}
+	return notBefore, nil
+}
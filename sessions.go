@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device. It is backed by a refresh token family:
+// every refresh token rotated from the same login shares its id.
+type Session struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	UserAgent       string    `json:"user_agent"`
+	IPAddress       string    `json:"ip_address"`
+}
+
+// startSession issues the first refresh token of a new family for userId and
+// returns it. The client's user agent and address are recorded with it.
+func (cfg *apiConfig) startSession(r *http.Request, q *database.Queries, userId uuid.UUID) (string, error) {
+	refreshToken := auth.MakeRefreshToken()
+	if _, err := q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    userId,
+		FamilyID:  uuid.New(),
+		UserAgent: r.UserAgent(),
+		IpAddress: cfg.clientIP(r),
+	}); err != nil {
+		return "", fmt.Errorf("could not create refresh token: %w", err)
+	}
+	return refreshToken, nil
+}
+
+func (cfg *apiConfig) getSessions(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	rows, err := cfg.dB.ListSessions(r.Context(), user_id)
+	if err != nil {
+		log.Printf("could not list sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	sessions := []Session{}
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:              row.FamilyID,
+			CreatedAt:       row.StartedAt,
+			LastRefreshedAt: row.LastRefreshedAt,
+			ExpiresAt:       row.ExpiresAt,
+			UserAgent:       row.UserAgent,
+			IPAddress:       row.IpAddress,
+		})
+	}
+	responseWithJson(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) deleteSession(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	sessionId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	revoked, err := cfg.dB.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionId,
+		UserID:   user_id,
+	})
+	if err != nil {
+		log.Printf("could not revoke session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logout ends the current access token and, when the client sends it, the
+// refresh token of the same session.
+func (cfg *apiConfig) logout(w http.ResponseWriter, r *http.Request) {
+	claims, user_id, err := cfg.accessClaims(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	var body logout
+	if err := body.decodeRequest(w, r); err != nil {
+		return
+	}
+	if err := cfg.revokeAccessToken(r.Context(), claims, user_id); err != nil {
+		log.Printf("could not revoke access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if body.RefreshToken != "" {
+		if err := cfg.dB.RevokeToken(r.Context(), auth.HashToken(body.RefreshToken)); err != nil {
+			log.Printf("could not revoke refresh token: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) logoutAll(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	notBefore, err := cfg.revokeUserTokens(r.Context(), cfg.dB, user_id)
+	if err != nil {
+		log.Printf("could not revoke tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	cfg.revocations.setCutoff(user_id, notBefore)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    $5
+)
+RETURNING *;
+
+-- name: ListAPITokens :many
+SELECT * FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetAPITokenByHash :one
+SELECT id, user_id, scopes, last_used_at FROM api_tokens
+WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchAPIToken :exec
+-- last_used_at is kept to the minute, so a busy token does not write on
+-- every request.
+UPDATE api_tokens
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - interval '1 minute');
+
+-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteAPITokens :exec
+DELETE FROM api_tokens
+WHERE user_id = $1;
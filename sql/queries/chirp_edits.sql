@@ -0,0 +1,19 @@
+-- name: CreateChirpEdit :exec
+INSERT INTO chirp_edits (id, chirp_id, body, created_at, replaced_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW()
+);
+
+-- name: GetChirpEdits :many
+SELECT * FROM chirp_edits
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
+
+
+-- name: DeleteChirpEdits :exec
+DELETE FROM chirp_edits
+WHERE chirp_id = $1;
\ No newline at end of file
@@ -1,27 +1,112 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
--- name: GetChirps :many
+-- name: ListChirps :many
 SELECT * FROM chirps
-ORDER BY created_at;
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_ids')::uuid[] IS NULL OR user_id = ANY(sqlc.narg('author_ids')::uuid[]))
+AND (sqlc.narg('created_after')::timestamp IS NULL OR created_at > sqlc.narg('created_after')::timestamp)
+AND (sqlc.narg('created_before')::timestamp IS NULL OR created_at < sqlc.narg('created_before')::timestamp)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg('row_limit');
 
--- name: GetChirpsByUser :many
+-- name: ListChirpsDesc :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at;
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_ids')::uuid[] IS NULL OR user_id = ANY(sqlc.narg('author_ids')::uuid[]))
+AND (sqlc.narg('created_after')::timestamp IS NULL OR created_at > sqlc.narg('created_after')::timestamp)
+AND (sqlc.narg('created_before')::timestamp IS NULL OR created_at < sqlc.narg('created_before')::timestamp)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetTimeline :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: SearchChirps :many
+-- The body is HTML-escaped before highlighting, so the <mark> tags are the
+-- only markup in the snippet.
+SELECT chirps.*,
+    ts_rank(to_tsvector('english', chirps.body), tsq)::real AS rank,
+    ts_headline('english',
+        replace(replace(replace(replace(replace(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+        tsq, 'StartSel=<mark>, StopSel=</mark>')::text AS snippet
+FROM chirps, websearch_to_tsquery('english', sqlc.arg('search_query')) AS tsq
+WHERE to_tsvector('english', chirps.body) @@ tsq
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('author_ids')::uuid[] IS NULL OR chirps.user_id = ANY(sqlc.narg('author_ids')::uuid[]))
+AND (sqlc.narg('created_after')::timestamp IS NULL OR chirps.created_at > sqlc.narg('created_after')::timestamp)
+AND (sqlc.narg('created_before')::timestamp IS NULL OR chirps.created_at < sqlc.narg('created_before')::timestamp)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpByIDForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE parent_id = $1
+);
+
+-- name: GetThreadRootID :one
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.parent_id FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT chirps.id, chirps.parent_id FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.parent_id
+)
+SELECT id FROM ancestors
+WHERE parent_id IS NULL;
+
+-- name: GetThread :many
+WITH RECURSIVE thread AS (
+    SELECT * FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT chirps.* FROM chirps
+    JOIN thread ON chirps.parent_id = thread.id
+)
+SELECT * FROM thread
+ORDER BY created_at, id;
+
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1 and user_id = $2;
\ No newline at end of file
+WHERE id = $1 and user_id = $2;
@@ -0,0 +1,15 @@
+-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (jti, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4
+);
+
+-- name: UseEmailVerification :one
+UPDATE email_verifications
+SET used_at = NOW()
+WHERE jti = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id, email;
@@ -0,0 +1,20 @@
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+);
+
+-- name: AttemptLoginChallenge :one
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg('token_hash') AND used_at IS NULL AND expires_at > NOW()
+    AND attempts < sqlc.arg('max_attempts')
+RETURNING user_id;
+
+-- name: UseLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
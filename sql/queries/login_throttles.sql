@@ -0,0 +1,52 @@
+-- name: LockLoginThrottle :one
+-- Creates the throttle if it does not exist yet, and locks its row until the
+-- end of the transaction.
+INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+VALUES (
+    $1,
+    $2,
+    0,
+    NOW()
+)
+ON CONFLICT (scope, key) DO UPDATE SET scope = EXCLUDED.scope
+RETURNING *;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+VALUES (
+    sqlc.arg('scope'),
+    sqlc.arg('key'),
+    1,
+    NOW()
+)
+ON CONFLICT (scope, key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < sqlc.arg('reset_before') THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING failures;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_throttles
+SET failures = failures - 1,
+    locked_until = CASE WHEN failures - 1 < sqlc.arg('free') THEN NULL ELSE locked_until END
+WHERE scope = sqlc.arg('scope') AND key = sqlc.arg('key') AND failures > 0;
+
+-- name: SetLoginLockout :exec
+UPDATE login_throttles
+SET locked_until = $3
+WHERE scope = $1 AND key = $2;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE scope = $1 AND key = $2;
+
+-- name: ListLoginLockouts :many
+SELECT * FROM login_throttles
+WHERE locked_until > NOW()
+ORDER BY locked_until DESC;
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
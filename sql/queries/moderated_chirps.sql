@@ -0,0 +1,13 @@
+-- name: CreateModeratedChirp :exec
+INSERT INTO moderated_chirps (id, chirp_id, original_body, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: GetModeratedChirps :many
+SELECT * FROM moderated_chirps
+WHERE chirp_id = $1
+ORDER BY created_at;
@@ -0,0 +1,33 @@
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    $5
+);
+
+-- name: UseOIDCLogin :one
+DELETE FROM oidc_logins
+WHERE state_hash = $1 AND expires_at > NOW()
+RETURNING provider, nonce, code_verifier;
+
+-- name: DeleteExpiredOIDCLogins :exec
+DELETE FROM oidc_logins
+WHERE expires_at <= NOW();
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+);
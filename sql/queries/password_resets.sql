@@ -0,0 +1,18 @@
+-- name: CreatePasswordReset :execrows
+-- Nothing is created when the user was already sent a reset after sent_after.
+INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+SELECT sqlc.arg('token_hash')::text, sqlc.arg('user_id')::uuid, NOW(), sqlc.arg('expires_at')::timestamp
+WHERE NOT EXISTS (
+    SELECT 1 FROM password_resets
+    WHERE user_id = sqlc.arg('user_id') AND created_at > sqlc.arg('sent_after')
+);
+
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: DeletePasswordResets :exec
+DELETE FROM password_resets
+WHERE user_id = $1;
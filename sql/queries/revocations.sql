@@ -0,0 +1,30 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, user_id, expires_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: ListRevokedAccessTokens :many
+SELECT jti, expires_at FROM revoked_access_tokens
+WHERE expires_at > $1;
+
+-- name: DeleteExpiredAccessTokenRevocations :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= $1;
+
+-- name: SetAccessTokenCutoff :one
+INSERT INTO access_token_cutoffs (user_id, not_before)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (user_id) DO UPDATE SET not_before = EXCLUDED.not_before
+RETURNING not_before;
+
+-- name: ListAccessTokenCutoffs :many
+SELECT * FROM access_token_cutoffs
+WHERE not_before > $1;
@@ -16,13 +16,47 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
 -- name: UpdateCreds :one
 UPDATE users
-SET hashed_password = $1, email = $2, updated_at = NOW()
+SET hashed_password = $1, email = $2, updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, email_verified_at;
+
+-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: UpdatePasswordHash :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: GetUserProfile :one
+SELECT users.id, users.created_at, users.is_chirpy_red, users.display_name, users.bio,
+    (
+        SELECT COUNT(*) FROM chirps
+        WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL
+    ) AS chirp_count
+FROM users
+WHERE users.id = $1;
+
+-- name: UpdateProfile :exec
+UPDATE users
+SET display_name = $1, bio = $2, updated_at = NOW()
+WHERE id = $3;
 
 -- name: UpgradeUser :exec
 UPDATE users
 SET is_chirpy_red = TRUE
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+-- name: VerifyEmail :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1 AND email = $2
+RETURNING *;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX chirps_body_search_idx ON chirps USING GIN (to_tsvector('english', body));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX chirps_body_search_idx;
+-- +goose StatementEnd
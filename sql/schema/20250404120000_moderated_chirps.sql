@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE moderated_chirps (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    original_body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+CREATE INDEX moderated_chirps_chirp_id_idx ON moderated_chirps (chirp_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE moderated_chirps;
+-- +goose StatementEnd
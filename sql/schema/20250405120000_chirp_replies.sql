@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chirps
+ADD parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD deleted_at TIMESTAMP;
+CREATE INDEX chirps_parent_id_idx ON chirps (parent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX chirps_parent_id_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Existing tokens are hashed in place. Clients still hold the plaintext,
+-- which the server hashes on every lookup, so they keep working until they
+-- expire.
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- The digests cannot be reversed, so every session has to log in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
+-- +goose StatementEnd
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+)
+
+// Failed logins are counted per account and per client address.
+const (
+	throttleScopeEmail = "email"
+	throttleScopeIP    = "ip"
+)
+
+const throttleCleanupInterval = time.Hour
+
+type loginThrottle struct {
+	scope   string
+	key     string
+	backoff auth.Backoff
+}
+
+type Lockout struct {
+	Scope         string    `json:"scope"`
+	Key           string    `json:"key"`
+	Failures      int32     `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// loginThrottles returns the throttles that apply to a login as email. The
+// email is counted whether or not it belongs to an account, so lockouts do
+// not reveal who has signed up.
+func (cfg *apiConfig) loginThrottles(r *http.Request, email string) []loginThrottle {
+	return []loginThrottle{
+		{scope: throttleScopeEmail, key: strings.ToLower(strings.TrimSpace(email)), backoff: auth.AccountBackoff},
+		{scope: throttleScopeIP, key: cfg.clientIP(r), backoff: auth.AddressBackoff},
+	}
+}
+
+// reserveLoginAttempts counts an attempt as a failure against every throttle
+// before the credentials are checked, and returns how long until a locked
+// throttle allows another attempt, or 0 when none of them is locked. Checking
+// and counting in one locked step means parallel guesses cannot all slip in
+// under the limit. A locked attempt counts against none of the throttles.
+func (cfg *apiConfig) reserveLoginAttempts(ctx context.Context, throttles []loginThrottle) (time.Duration, error) {
+	for i, throttle := range throttles {
+		wait, err := cfg.reserveLoginAttempt(ctx, throttle)
+		if err != nil || wait > 0 {
+			cfg.releaseLoginAttempts(ctx, throttles[:i])
+			return wait, err
+		}
+	}
+	return 0, nil
+}
+
+func (cfg *apiConfig) reserveLoginAttempt(ctx context.Context, throttle loginThrottle) (time.Duration, error) {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	row, err := qtx.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+		Scope: throttle.scope,
+		Key:   throttle.key,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not lock login throttle: %w", err)
+	}
+	if row.LockedUntil.Valid {
+		if wait := time.Until(row.LockedUntil.Time); wait > 0 {
+			return wait, nil
+		}
+	}
+	failures, err := qtx.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Scope:       throttle.scope,
+		Key:         throttle.key,
+		ResetBefore: time.Now().UTC().Add(-throttle.backoff.Reset),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not record login failure: %w", err)
+	}
+	if lockout := throttle.backoff.Lockout(int(failures)); lockout > 0 {
+		if err := qtx.SetLoginLockout(ctx, database.SetLoginLockoutParams{
+			Scope:       throttle.scope,
+			Key:         throttle.key,
+			LockedUntil: sql.NullTime{Time: time.Now().UTC().Add(lockout), Valid: true},
+		}); err != nil {
+			return 0, fmt.Errorf("could not set login lockout: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit login attempt: %w", err)
+	}
+	return 0, nil
+}
+
+// releaseLoginAttempts takes back an attempt reserved by
+// reserveLoginAttempts once the credentials turned out to be right, and lifts
+// a lockout the attempt caused. Errors are only logged; the attempt then
+// stays counted.
+func (cfg *apiConfig) releaseLoginAttempts(ctx context.Context, throttles []loginThrottle) {
+	for _, throttle := range throttles {
+		if err := cfg.dB.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{
+			Free:  int32(throttle.backoff.Free),
+			Scope: throttle.scope,
+			Key:   throttle.key,
+		}); err != nil {
+			log.Printf("could not release login attempt: %s", err)
+		}
+	}
+}
+
+// clearLoginFailures forgets the failed attempts against an account once a
+// login has fully succeeded, second factor included. The address keeps its count, so one working account does
+// not reset an attacker's budget for guessing others.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, throttles []loginThrottle) {
+	for _, throttle := range throttles {
+		if throttle.scope != throttleScopeEmail {
+			continue
+		}
+		if err := cfg.dB.ClearLoginThrottle(ctx, database.ClearLoginThrottleParams{
+			Scope: throttle.scope,
+			Key:   throttle.key,
+		}); err != nil {
+			log.Printf("could not clear login throttle: %s", err)
+		}
+	}
+}
+
+func respondLockedOut(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+}
+
+// cleanupLoginThrottles periodically deletes throttles whose failures are
+// too old to count, so guesses at made-up emails do not pile up.
+func (cfg *apiConfig) cleanupLoginThrottles(ctx context.Context) {
+	ticker := time.NewTicker(throttleCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().UTC().Add(-max(auth.AccountBackoff.Reset, auth.AddressBackoff.Reset))
+			if err := cfg.dB.DeleteStaleLoginThrottles(ctx, before); err != nil {
+				log.Printf("could not delete stale login throttles: %s", err)
+			}
+		}
+	}
+}
+
+// getLockouts lists the accounts and addresses that are locked out right now.
+func (cfg *apiConfig) getLockouts(w http.ResponseWriter, r *http.Request) {
+	if !cfg.checkAdminKey(w, r) {
+		return
+	}
+	rows, err := cfg.dB.ListLoginLockouts(r.Context())
+	if err != nil {
+		log.Printf("could not list login lockouts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	lockouts := []Lockout{}
+	for _, row := range rows {
+		lockouts = append(lockouts, Lockout{
+			Scope:         row.Scope,
+			Key:           row.Key,
+			Failures:      row.Failures,
+			LastFailureAt: row.LastFailureAt,
+			LockedUntil:   row.LockedUntil.Time,
+		})
+	}
+	responseWithJson(w, http.StatusOK, lockouts)
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
 )
 
 type token struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// makeAccessToken issues a short lived access token for a signed in user.
+func (cfg *apiConfig) makeAccessToken(userId uuid.UUID, isChirpyRed bool) (string, error) {
+	return auth.MakeJWT(auth.NewClaims(userId, isChirpyRed, auth.UserScopes...), cfg.tokens, accessTokenLifetime)
 }
 
 func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -18,37 +27,99 @@ func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request)
 		log.Printf("could not retrieve refresh token: %s", err)
 		return
 	}
-	if err = cfg.dB.RevokeToken(r.Context(), refresh); err != nil {
+	if err = cfg.dB.RevokeToken(r.Context(), auth.HashToken(refresh)); err != nil {
 		log.Printf("could not revoke refresh token: %s", err)
 		return
 	}
 	responseWithJson(w, 204, nil)
 }
 
+// postRefreshToken exchanges a refresh token for a new access token and a new
+// refresh token in the same family. The presented token is revoked, and
+// presenting it again revokes the whole family.
 func (cfg *apiConfig) postRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refresh, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		log.Printf("could not retrieve refresh token: %s", err)
 		return
 	}
-	refreshToken, err := cfg.dB.GetRefreshToken(r.Context(), refresh)
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("Refresh token does not exist: %s", err)
-		respondWithError(w, 401, "Invalid Token")
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	currentTime := time.Now()
-	if currentTime.Sub(refreshToken.ExpiresAt) >= 0 || refreshToken.RevokedAt.Valid {
-		log.Printf("Refresh token expired")
-		respondWithError(w, 401, "Invalid Token")
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	refreshToken, err := qtx.RotateRefreshToken(r.Context(), auth.HashToken(refresh))
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.rejectRefreshToken(w, r, refresh)
+		return
+	}
+	if err != nil {
+		log.Printf("could not rotate refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	newRefresh := auth.MakeRefreshToken()
+	if _, err := qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(newRefresh),
+		UserID:    refreshToken.UserID,
+		FamilyID:  refreshToken.FamilyID,
+		UserAgent: refreshToken.UserAgent,
+		IpAddress: refreshToken.IpAddress,
+	}); err != nil {
+		log.Printf("could not create refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	user, err := qtx.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	newAccess, err := auth.MakeJWT(refreshToken.UserID, cfg.secret, time.Hour)
+	newAccess, err := cfg.makeAccessToken(user.ID, user.IsChirpyRed)
 	if err != nil {
 		log.Printf("could not make new jwt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit refresh token rotation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
 	}
 	responseWithJson(w, 200, token{
-		Token: newAccess,
+		Token:        newAccess,
+		RefreshToken: newRefresh,
 	})
+}
+
+// rejectRefreshToken responds to a refresh token that could not be rotated.
+// A token that was already rotated is being replayed, most likely by someone
+// who stole it, so every token in its family is revoked.
+func (cfg *apiConfig) rejectRefreshToken(w http.ResponseWriter, r *http.Request, refresh string) {
+	refreshToken, err := cfg.dB.GetRefreshToken(r.Context(), auth.HashToken(refresh))
+	if err != nil {
+		log.Printf("Refresh token does not exist: %s", err)
+		respondWithError(w, 401, "Invalid Token")
+		return
+	}
+	if refreshToken.RotatedAt.Valid {
+		log.Printf("Refresh token reused, revoking family %s", refreshToken.FamilyID)
+		if err := cfg.dB.RevokeTokenFamily(r.Context(), refreshToken.FamilyID); err != nil {
+			log.Printf("could not revoke refresh token family: %s", err)
+		}
+	} else {
+		log.Printf("Refresh token expired")
+	}
+	respondWithError(w, 401, "Invalid Token")
+}
 
+// getJWKS publishes the public keys that verify access tokens, so other
+// services can check our tokens without holding a signing secret.
+func (cfg *apiConfig) getJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	responseWithJson(w, http.StatusOK, cfg.tokens.Keys.JWKS())
 }
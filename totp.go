@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	loginChallengeLifetime    = 5 * time.Minute
+	maxLoginChallengeAttempts = 5
+	recoveryCodeCount         = 10
+	totpIssuer                = "Chirpy"
+)
+
+// LoginChallenge is the response to a correct password from a user with
+// two-factor authentication enabled. The challenge token is exchanged for
+// access and refresh tokens at POST /api/login/totp.
+type LoginChallenge struct {
+	TOTPRequired   bool      `json:"totp_required"`
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// totpEnabled reports whether userId has confirmed a TOTP enrollment.
+func (cfg *apiConfig) totpEnabled(ctx context.Context, userId uuid.UUID) (bool, error) {
+	credential, err := cfg.dB.GetTOTPCredential(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not get totp credential: %w", err)
+	}
+	return credential.ConfirmedAt.Valid, nil
+}
+
+// checkSecondFactor reports whether code is a current TOTP code or an unused
+// recovery code of userId, and uses it up either way so it cannot be
+// replayed.
+func checkSecondFactor(ctx context.Context, q *database.Queries, userId uuid.UUID, code string) (bool, error) {
+	credential, err := q.GetTOTPCredential(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not get totp credential: %w", err)
+	}
+	if !credential.ConfirmedAt.Valid {
+		return false, nil
+	}
+	if step, err := auth.ValidateTOTP(credential.Secret, code, time.Now()); err == nil {
+		rows, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			UserID:   userId,
+			LastStep: step,
+		})
+		if err != nil {
+			return false, fmt.Errorf("could not use totp step: %w", err)
+		}
+		return rows == 1, nil
+	}
+	rows, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   userId,
+		CodeHash: auth.HashRecoveryCode(code),
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not use recovery code: %w", err)
+	}
+	return rows == 1, nil
+}
+
+// startLoginChallenge responds with a short-lived challenge token in place of
+// the access and refresh tokens. Only a digest of the token is stored.
+func (cfg *apiConfig) startLoginChallenge(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	token := auth.MakeRefreshToken()
+	expiresAt := time.Now().UTC().Add(loginChallengeLifetime)
+	if err := cfg.dB.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userId,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		log.Printf("could not save login challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	responseWithJson(w, http.StatusOK, LoginChallenge{
+		TOTPRequired:   true,
+		ChallengeToken: token,
+		ExpiresAt:      expiresAt,
+	})
+}
+
+// loginTOTP finishes a login that was answered with a challenge. Each
+// challenge allows a few wrong codes before the user has to enter their
+// password again, and wrong codes count against the same throttles as wrong
+// passwords.
+func (cfg *apiConfig) loginTOTP(w http.ResponseWriter, r *http.Request) {
+	var req totpLogin
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	tokenHash := auth.HashToken(req.ChallengeToken)
+	userId, err := cfg.dB.AttemptLoginChallenge(r.Context(), database.AttemptLoginChallengeParams{
+		TokenHash:   tokenHash,
+		MaxAttempts: maxLoginChallengeAttempts,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge token")
+		return
+	}
+	if err != nil {
+		log.Printf("could not attempt login challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	user, err := cfg.dB.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	throttles := cfg.loginThrottles(r, user.Email)
+	wait, err := cfg.reserveLoginAttempts(r.Context(), throttles)
+	if err != nil {
+		log.Printf("could not check login lockout: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+	ok, err := checkSecondFactor(r.Context(), cfg.dB, userId, req.Code)
+	if err != nil {
+		log.Printf("could not check second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "invalid totp or recovery code")
+		return
+	}
+	cfg.releaseLoginAttempts(r.Context(), throttles)
+	rows, err := cfg.dB.UseLoginChallenge(r.Context(), tokenHash)
+	if err != nil {
+		log.Printf("could not use login challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge token")
+		return
+	}
+	cfg.completeLogin(w, r, &user)
+}
+
+// enrollTOTP generates a new secret for the user. Login does not ask for a
+// code until the enrollment is confirmed, and enrolling again before that
+// replaces the secret.
+func (cfg *apiConfig) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	user, err := cfg.dB.GetUserByID(r.Context(), user_id)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	secret := auth.GenerateTOTPSecret()
+	rows, err := cfg.dB.CreateTOTPCredential(r.Context(), database.CreateTOTPCredentialParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		log.Printf("could not save totp credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusConflict, "two-factor authentication already enabled")
+		return
+	}
+	responseWithJson(w, http.StatusOK, TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// confirmTOTP enables two-factor authentication once the user proves their
+// authenticator works, and responds with their recovery codes. This is the
+// only time the recovery codes are shown.
+func (cfg *apiConfig) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req totpCode
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	credential, err := cfg.dB.GetTOTPCredential(r.Context(), user_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "no pending totp enrollment")
+		return
+	}
+	if err != nil {
+		log.Printf("could not get totp credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if credential.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "two-factor authentication already enabled")
+		return
+	}
+	step, err := auth.ValidateTOTP(credential.Secret, req.Code, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid totp code")
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	rows, err := qtx.ConfirmTOTPCredential(r.Context(), database.ConfirmTOTPCredentialParams{
+		UserID:   user_id,
+		LastStep: step,
+	})
+	if err != nil {
+		log.Printf("could not confirm totp credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusConflict, "two-factor authentication already enabled")
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user_id); err != nil {
+		log.Printf("could not delete recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	codes := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	for _, code := range codes {
+		if err := qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(code),
+			UserID:   user_id,
+		}); err != nil {
+			log.Printf("could not save recovery code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit totp confirmation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	responseWithJson(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
+
+// disableTOTP turns two-factor authentication off. It takes a TOTP or
+// recovery code, so a stolen access token alone cannot do it, and wrong codes
+// count against the same throttles as at login so the code cannot be guessed.
+func (cfg *apiConfig) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req totpCode
+	if err := req.decodeRequest(w, r); err != nil {
+		return
+	}
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	user, err := cfg.dB.GetUserByID(r.Context(), user_id)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	throttles := cfg.loginThrottles(r, user.Email)
+	wait, err := cfg.reserveLoginAttempts(r.Context(), throttles)
+	if err != nil {
+		log.Printf("could not check login lockout: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	ok, err := checkSecondFactor(r.Context(), qtx, user_id, req.Code)
+	if err != nil {
+		log.Printf("could not check second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "invalid totp or recovery code")
+		return
+	}
+	cfg.releaseLoginAttempts(r.Context(), throttles)
+	if err := qtx.DeleteTOTPCredential(r.Context(), user_id); err != nil {
+		log.Printf("could not delete totp credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user_id); err != nil {
+		log.Printf("could not delete recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit totp removal: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
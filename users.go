@@ -1,23 +1,51 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/NHemmerly/http-servers/internal/auth"
 	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/validation"
 	"github.com/google/uuid"
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+}
+
+// Profile is the public view of a user. It never includes the email address
+// or password hash.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ChirpCount  int64     `json:"chirp_count"`
+	DisplayName *string   `json:"display_name"`
+	Bio         *string   `json:"bio"`
+}
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+func nullStringPointer(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
 }
 
 func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
@@ -26,50 +54,105 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
+	throttles := cfg.loginThrottles(r, req.Email)
+	wait, err := cfg.reserveLoginAttempts(r.Context(), throttles)
+	if err != nil {
+		log.Printf("could not check login lockout: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+	// unknown emails and wrong passwords get the same response in the same
+	// time, so login does not reveal who has signed up
 	user, err := cfg.getUserByEmail(req.Email, r)
 	if err != nil {
-		respondWithError(w, 401, "user not found")
+		auth.CheckPasswordHash(req.Password, cfg.dummyHash)
+		respondWithError(w, 401, "incorrect email or password")
 		return
 	}
 	if err = auth.CheckPasswordHash(req.Password, user.HashedPassword); err != nil {
 		respondWithError(w, 401, "incorrect email or password")
 		return
 	}
-	token, err := auth.MakeJWT(user.ID, cfg.secret, time.Hour)
+	cfg.releaseLoginAttempts(r.Context(), throttles)
+	cfg.rehashPassword(r, user, req.Password)
+	enabled, err := cfg.totpEnabled(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("could not check totp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if enabled {
+		cfg.startLoginChallenge(w, r, user.ID)
+		return
+	}
+	cfg.completeLogin(w, r, user)
+}
+
+// completeLogin issues an access token and starts a session for a user who
+// has proven who they are, and forgets the failed logins against their
+// account.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user *database.User) {
+	cfg.clearLoginFailures(r.Context(), cfg.loginThrottles(r, user.Email))
+	token, err := cfg.makeAccessToken(user.ID, user.IsChirpyRed)
 	if err != nil {
 		log.Printf("could not create jwt token")
 		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	newRefToken, err := cfg.dB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  auth.MakeRefreshToken(),
-		UserID: user.ID,
-	})
+	refreshToken, err := cfg.startSession(r, cfg.dB, user.ID)
 	if err != nil {
-		log.Printf("could not create RefreshToken: %s", err)
+		log.Printf("could not start session: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
 	responseWithJson(w, 200, User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: newRefToken.Token,
-		IsChirpyRed:  user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Token:         token,
+		RefreshToken:  refreshToken,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	})
 }
 
+// rehashPassword upgrades the stored hash of a user who just logged in when
+// it was made with an outdated algorithm or cost. Failures only delay the
+// upgrade to the next login.
+func (cfg *apiConfig) rehashPassword(r *http.Request, user *database.User, password string) {
+	if !cfg.hasher.NeedsRehash(user.HashedPassword) {
+		return
+	}
+	hash, err := cfg.hasher.Hash(password)
+	if err != nil {
+		log.Printf("could not rehash password: %s", err)
+		return
+	}
+	if err := cfg.dB.UpdatePasswordHash(r.Context(), database.UpdatePasswordHashParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	}); err != nil {
+		log.Printf("could not update password hash: %s", err)
+	}
+}
+
 func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
 	params := login{}
 	params.decodeRequest(w, req)
-	if params.Password == "" {
-		log.Printf("No password provided")
-		w.WriteHeader(400)
+	if err := validation.Email(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkPassword(w, params.Password, params.Email) {
 		return
 	}
-	hash, err := auth.HashPassword(params.Password)
+	hash, err := cfg.hasher.Hash(params.Password)
 	if err != nil {
 		log.Printf("could not hash password")
 		w.WriteHeader(500)
@@ -83,6 +166,10 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
 		log.Printf("could not create user: %s", err)
 		return
 	}
+	// the account still works without the email, and the user can ask for another one
+	if err := cfg.sendVerificationEmail(req.Context(), user.ID, user.Email); err != nil {
+		log.Printf("could not send verification email: %s", err)
+	}
 	responseWithJson(w, 201, User{
 		ID:          user.ID,
 		CreatedAt:   user.CreatedAt,
@@ -93,30 +180,39 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) updateLogin(w http.ResponseWriter, r *http.Request) {
-	access, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("could not retrieve access token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "no access token")
-		return
-	}
 	var creds login
 	if err := creds.decodeRequest(w, r); err != nil {
 		log.Printf("could not decode request: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "server error")
 		return
 	}
-	uuid, err := auth.ValidateJWT(access, cfg.secret)
+	uuid, err := cfg.authenticate(r)
 	if err != nil {
 		log.Printf("could not validate user: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
 		return
 	}
-	hashed, err := auth.HashPassword(creds.Password)
+	if err := validation.Email(creds.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkPassword(w, creds.Password, creds.Email) {
+		return
+	}
+	hashed, err := cfg.hasher.Hash(creds.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not hash password")
 		return
 	}
-	user, err := cfg.dB.UpdateCreds(r.Context(), database.UpdateCredsParams{
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	user, err := qtx.UpdateCreds(r.Context(), database.UpdateCredsParams{
 		HashedPassword: hashed,
 		Email:          creds.Email,
 		ID:             uuid,
@@ -125,12 +221,32 @@ func (cfg *apiConfig) updateLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "could not update db")
 		return
 	}
+	// a new password ends every existing session, including this one
+	notBefore, err := cfg.revokeUserTokens(r.Context(), qtx, user.ID)
+	if err != nil {
+		log.Printf("could not revoke tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit credential update: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	cfg.revocations.setCutoff(user.ID, notBefore)
+	// a new email address has to be verified again
+	if !user.EmailVerifiedAt.Valid {
+		if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+			log.Printf("could not send verification email: %s", err)
+		}
+	}
 	responseWithJson(w, http.StatusOK, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	})
 
 }
@@ -165,3 +281,83 @@ func (cfg *apiConfig) upgradeChirpyRed(w http.ResponseWriter, r *http.Request) {
 	}
 	respondWithError(w, http.StatusNoContent, "user updated")
 }
+
+func (cfg *apiConfig) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	profile, err := cfg.dB.GetUserProfile(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	responseWithJson(w, http.StatusOK, Profile{
+		ID:          profile.ID,
+		CreatedAt:   profile.CreatedAt,
+		IsChirpyRed: profile.IsChirpyRed,
+		ChirpCount:  profile.ChirpCount,
+		DisplayName: nullStringPointer(profile.DisplayName),
+		Bio:         nullStringPointer(profile.Bio),
+	})
+}
+
+// updateProfile changes the fields present in the request. An empty string
+// clears a field.
+func (cfg *apiConfig) updateProfile(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authorize(r, auth.ScopeProfileWrite)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not parse path")
+		return
+	}
+	if userId != user_id {
+		respondWithError(w, http.StatusForbidden, "Unauthorized")
+		return
+	}
+	var update profileUpdate
+	if err := update.decodeRequest(w, r); err != nil {
+		return
+	}
+	user, err := cfg.dB.GetUserByID(r.Context(), user_id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	displayName, bio := user.DisplayName, user.Bio
+	if update.DisplayName != nil {
+		if displayName, err = profileField(*update.DisplayName, maxDisplayNameLength); err != nil || strings.Contains(displayName.String, "\n") {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("display_name must be a single line of at most %d characters", maxDisplayNameLength))
+			return
+		}
+	}
+	if update.Bio != nil {
+		if bio, err = profileField(*update.Bio, maxBioLength); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bio must be at most %d characters", maxBioLength))
+			return
+		}
+	}
+	if err := cfg.dB.UpdateProfile(r.Context(), database.UpdateProfileParams{
+		DisplayName: displayName,
+		Bio:         bio,
+		ID:          user_id,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not update db")
+		return
+	}
+	cfg.getUserProfile(w, r)
+}
+
+func profileField(value string, maxLength int) (sql.NullString, error) {
+	normalized, err := validation.Text(strings.TrimSpace(value), maxLength)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: normalized, Valid: normalized != ""}, nil
+}
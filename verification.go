@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NHemmerly/http-servers/internal/auth"
+	"github.com/NHemmerly/http-servers/internal/database"
+	"github.com/NHemmerly/http-servers/internal/mail"
+	"github.com/google/uuid"
+)
+
+const emailVerificationLifetime = 24 * time.Hour
+
+// sendVerificationEmail mails userId a single use link that confirms they
+// can read mail sent to email.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userId uuid.UUID, email string) error {
+	token, claims, err := auth.MakeEmailVerificationToken(userId, email, cfg.tokens, emailVerificationLifetime)
+	if err != nil {
+		return fmt.Errorf("could not make verification token: %w", err)
+	}
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("could not parse jti: %w", err)
+	}
+	if err := cfg.dB.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		Jti:       jti,
+		UserID:    userId,
+		Email:     email,
+		ExpiresAt: claims.ExpiresAt.Time.UTC(),
+	}); err != nil {
+		return fmt.Errorf("could not save verification: %w", err)
+	}
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", cfg.baseURL, url.QueryEscape(token))
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Open this link to verify your email address and start chirping:\n\n%s\n\n"+
+			"The link expires in 24 hours. If you did not sign up for Chirpy, ignore this email.\n", link),
+	})
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.ParseEmailVerificationToken(r.URL.Query().Get("token"), cfg.tokens)
+	if err != nil {
+		log.Printf("could not validate verification token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dB.WithTx(tx)
+	verification, err := qtx.UseEmailVerification(r.Context(), jti)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		log.Printf("could not use verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if verification.Email != claims.Email || verification.UserID.String() != claims.Subject {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+	// the email no longer matches when the user changed it after the link was sent
+	user, err := qtx.VerifyEmail(r.Context(), database.VerifyEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "email address has changed")
+		return
+	}
+	if err != nil {
+		log.Printf("could not verify email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	responseWithJson(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: true,
+	})
+}
+
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, r *http.Request) {
+	user_id, err := cfg.authenticate(r)
+	if err != nil {
+		log.Printf("could not authenticate: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "unauthorized user")
+		return
+	}
+	user, err := cfg.dB.GetUserByID(r.Context(), user_id)
+	if err != nil {
+		log.Printf("could not get user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "email address already verified")
+		return
+	}
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("could not send verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}